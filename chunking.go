@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	chunkSizeKey            = "chunk_size"
+	chunkDefaultMaxParallel = 2
+	mergeCodesConcat        = "concat"
+	mergeCodesDedupe        = "dedupe"
+	mergeDocTopicUnion      = "union"
+	mergeDocTopicOffset     = "offset"
+	mergeMetricsMean        = "mean"
+	mergeMetricsSum         = "sum"
+	mergeMetricsFirst       = "first"
+	mergeTopicsPrefix       = "prefix"
+	mergeTopicsFirst        = "first"
+)
+
+// MergeStrategies model, how the results of the batches of a chunked detection are merged.
+// codes: concat (default) or dedupe by name and tore, doc_topic: union (default) or offset
+// (numeric document keys are shifted by the position of the batch), metrics: mean (default,
+// weighted by batch size), sum or first, topics: prefix (default, keys are prefixed with the batch) or first.
+type MergeStrategies struct {
+	Codes    string `json:"codes,omitempty"`
+	DocTopic string `json:"doc_topic,omitempty"`
+	Metrics  string `json:"metrics,omitempty"`
+	Topics   string `json:"topics,omitempty"`
+}
+
+// ChunkingConfig model, datasets with more than batch_size documents are sent to the method in batches
+type ChunkingConfig struct {
+	BatchSize   int             `json:"batch_size"`
+	MaxParallel int             `json:"max_parallel,omitempty"`
+	Merge       MergeStrategies `json:"merge"`
+}
+
+// validate returns an error if a merge strategy is unknown or the method family cannot be chunked
+func (c ChunkingConfig) validate(family string) error {
+	valid := map[string][]string{
+		"codes":     {"", mergeCodesConcat, mergeCodesDedupe},
+		"doc_topic": {"", mergeDocTopicUnion, mergeDocTopicOffset},
+		"metrics":   {"", mergeMetricsMean, mergeMetricsSum, mergeMetricsFirst},
+		"topics":    {"", mergeTopicsPrefix, mergeTopicsFirst},
+	}
+	strategies := map[string]string{
+		"codes":     c.Merge.Codes,
+		"doc_topic": c.Merge.DocTopic,
+		"metrics":   c.Merge.Metrics,
+		"topics":    c.Merge.Topics,
+	}
+	for field, strategy := range strategies {
+		found := false
+		for _, allowed := range valid[field] {
+			if strategy == allowed {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown %s merge strategy %s", field, strategy)
+		}
+	}
+	if c.BatchSize > 0 && family == familyConceptExtraction {
+		return fmt.Errorf("concept extraction methods return codes with token references and cannot be chunked")
+	}
+	if c.BatchSize < 0 || c.MaxParallel < 0 {
+		return fmt.Errorf("batch_size and max_parallel must not be negative")
+	}
+	return nil
+}
+
+// parseChunkSize validates the optional chunk size of a request body, 0 means the method default is used
+func parseChunkSize(body map[string]interface{}) (int, *ParamError) {
+	value, exists := body[chunkSizeKey]
+	if !exists || value == nil {
+		return 0, nil
+	}
+	number, ok := toNumber(value)
+	if !ok || number != float64(int(number)) || number < 1 {
+		return 0, &ParamError{Field: chunkSizeKey, Message: "must be an integer >= 1"}
+	}
+	return int(number), nil
+}
+
+// checkChunkable rejects a chunk size for methods whose codes reference tokens
+func checkChunkable(method string, chunkSize int) *ParamError {
+	if chunkSize > 0 && methodRegistry.Resolve(method).Family == familyConceptExtraction {
+		return &ParamError{Field: chunkSizeKey, Message: "method returns codes with token references and cannot be chunked"}
+	}
+	return nil
+}
+
+// runDetection sends the run to the method, in batches if the dataset is larger than the chunk size
+func runDetection(result Result, run Run) (Result, error) {
+	chunking := runChunking(run)
+	if chunking.BatchSize <= 0 || len(run.Dataset.Documents) <= chunking.BatchSize {
+		return callMethod(result, run)
+	}
+	return runChunkedDetection(result, run, chunking)
+}
+
+// runChunking returns the chunking config of the method, the chunk size of the run overrides its batch size
+func runChunking(run Run) ChunkingConfig {
+	chunking := ChunkingConfig{}
+	if method := methodRegistry.Resolve(run.Method); method.Chunking != nil {
+		chunking = *method.Chunking
+	}
+	if run.ChunkSize > 0 {
+		chunking.BatchSize = run.ChunkSize
+	}
+	return chunking
+}
+
+// splitRun splits the documents of the run into batches and returns the batches with their offsets
+func splitRun(run Run, batchSize int) ([]Run, []int) {
+	documents := run.Dataset.Documents
+	var batches []Run
+	var offsets []int
+	for start := 0; start < len(documents); start += batchSize {
+		end := start + batchSize
+		if end > len(documents) {
+			end = len(documents)
+		}
+		batch := run
+		batch.Dataset = Dataset{
+			UploadedAt: run.Dataset.UploadedAt,
+			Name:       run.Dataset.Name,
+			Size:       end - start,
+			Documents:  documents[start:end],
+		}
+		batches = append(batches, batch)
+		offsets = append(offsets, start)
+	}
+	return batches, offsets
+}
+
+func runChunkedDetection(result Result, run Run, chunking ChunkingConfig) (Result, error) {
+	documents := run.Dataset.Documents
+	batches, offsets := splitRun(run, chunking.BatchSize)
+
+	maxParallel := chunking.MaxParallel
+	if maxParallel <= 0 {
+		maxParallel = chunkDefaultMaxParallel
+	}
+	logJob(result, "sending %d documents in %d batches of %d, %d at a time", len(documents), len(batches), chunking.BatchSize, maxParallel)
+
+	batchResults := make([]Result, len(batches))
+	errs := make([]error, len(batches))
+	running := make(chan struct{}, maxParallel)
+	var wg sync.WaitGroup
+	for i, batch := range batches {
+		wg.Add(1)
+		running <- struct{}{}
+		go func(i int, batch Run) {
+			defer wg.Done()
+			defer func() { <-running }()
+			batchResults[i], errs[i] = callMethod(Result{Name: result.Name, Owner: result.Owner}, batch)
+			if errs[i] == nil {
+				logJob(result, "batch %d of %d finished", i+1, len(batches))
+			}
+		}(i, batch)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return result, fmt.Errorf("batch %d of %d failed: %w", i+1, len(batches), err)
+		}
+	}
+	return mergeBatchResults(result, batchResults, batches, offsets, chunking.Merge)
+}
+
+// mergeBatchResults merges the codes, topics, doc topics and metrics of the batches into the result.
+// Codes that reference tokens or relationships cannot be merged, their indices are relative to their batch
+func mergeBatchResults(result Result, batchResults []Result, batches []Run, offsets []int, merge MergeStrategies) (Result, error) {
+	for i, batchResult := range batchResults {
+		for _, code := range batchResult.Codes {
+			if len(code.Tokens) > 0 || len(code.RelationshipMemberships) > 0 {
+				return result, fmt.Errorf("batch %d of %d returned codes with token references, which cannot be merged across batches", i+1, len(batchResults))
+			}
+		}
+	}
+
+	result.Codes = nil
+	seenCodes := make(map[string]bool)
+	for _, batchResult := range batchResults {
+		for _, code := range batchResult.Codes {
+			if merge.Codes == mergeCodesDedupe {
+				key := strings.ToLower(code.Name) + "\x00" + code.Tore
+				if seenCodes[key] {
+					continue
+				}
+				seenCodes[key] = true
+			}
+			index := len(result.Codes)
+			code.Index = &index
+			result.Codes = append(result.Codes, code)
+		}
+	}
+
+	result.Topics = make(map[string]interface{})
+	for i, batchResult := range batchResults {
+		for topic, words := range batchResult.Topics {
+			if merge.Topics == mergeTopicsFirst {
+				if _, exists := result.Topics[topic]; !exists {
+					result.Topics[topic] = words
+				}
+				continue
+			}
+			result.Topics[fmt.Sprintf("%d-%s", i, topic)] = words
+		}
+	}
+
+	result.DocTopic = make(map[string]interface{})
+	for i, batchResult := range batchResults {
+		for document, topics := range batchResult.DocTopic {
+			if merge.DocTopic == mergeDocTopicOffset {
+				if index, err := strconv.Atoi(document); err == nil {
+					document = strconv.Itoa(index + offsets[i])
+				}
+			}
+			result.DocTopic[document] = topics
+		}
+	}
+
+	result.Metrics = make(map[string]interface{})
+	sums := make(map[string]float64)
+	weights := make(map[string]float64)
+	for i, batchResult := range batchResults {
+		weight := float64(len(batches[i].Dataset.Documents))
+		for _, metric := range sortedMetricKeys(batchResult.Metrics) {
+			value := batchResult.Metrics[metric]
+			number, isNumber := value.(float64)
+			switch {
+			case merge.Metrics == mergeMetricsFirst || !isNumber:
+				if _, exists := result.Metrics[metric]; !exists {
+					result.Metrics[metric] = value
+				}
+			case merge.Metrics == mergeMetricsSum:
+				sums[metric] += number
+				weights[metric] = 1
+			default:
+				sums[metric] += number * weight
+				weights[metric] += weight
+			}
+		}
+	}
+	for metric, sum := range sums {
+		if merge.Metrics == mergeMetricsSum {
+			result.Metrics[metric] = sum
+		} else {
+			result.Metrics[metric] = sum / weights[metric]
+		}
+	}
+	result.Metrics["chunk_batches"] = float64(len(batchResults))
+	return result, nil
+}
+
+func sortedMetricKeys(metrics map[string]interface{}) []string {
+	keys := make([]string, 0, len(metrics))
+	for key := range metrics {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
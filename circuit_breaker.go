@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+
+	defaultCircuitThreshold   = 5
+	defaultCircuitOpenSeconds = 30
+)
+
+// CircuitBreaker model, the state of the circuit breaker of a downstream service
+type CircuitBreaker struct {
+	Service   string     `json:"service"`
+	Host      string     `json:"host"`
+	State     string     `json:"state"`
+	Failures  int        `json:"failures"`
+	OpenedAt  *time.Time `json:"opened_at,omitempty"`
+	RetryAt   *time.Time `json:"retry_at,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	probing   bool
+}
+
+// CircuitOpenError is returned instead of sending a request to a service whose circuit breaker is open
+type CircuitOpenError struct {
+	Service string
+	RetryAt time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker open for %s, the service is unavailable, retrying after %s",
+		e.Service, e.RetryAt.Format(time.RFC3339))
+}
+
+// CircuitBreakers opens the circuit of a service after threshold consecutive failures (connection errors,
+// timeouts, 502, 503 and 504 responses). Requests to an open service fail fast; after openDuration a
+// single probe request is let through (half-open), its outcome closes or reopens the circuit.
+type CircuitBreakers struct {
+	mu           sync.Mutex
+	breakers     map[string]*CircuitBreaker
+	threshold    int
+	openDuration time.Duration
+	now          func() time.Time
+}
+
+var circuitBreakers = newCircuitBreakers(
+	envInt("CIRCUIT_BREAKER_THRESHOLD", defaultCircuitThreshold),
+	time.Duration(envInt("CIRCUIT_BREAKER_OPEN_SECONDS", defaultCircuitOpenSeconds))*time.Second,
+)
+
+func newCircuitBreakers(threshold int, openDuration time.Duration) *CircuitBreakers {
+	return &CircuitBreakers{
+		breakers:     make(map[string]*CircuitBreaker),
+		threshold:    threshold,
+		openDuration: openDuration,
+		now:          time.Now,
+	}
+}
+
+func envInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// Allow returns an error if no request may be sent to the service on the host
+func (c *CircuitBreakers) Allow(service string, host string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	breaker, ok := c.breakers[service]
+	if !ok {
+		breaker = &CircuitBreaker{Service: service, Host: host, State: circuitClosed}
+		c.breakers[service] = breaker
+	}
+
+	switch breaker.State {
+	case circuitOpen:
+		if c.now().Before(*breaker.RetryAt) {
+			return &CircuitOpenError{Service: service, RetryAt: *breaker.RetryAt}
+		}
+		breaker.State = circuitHalfOpen
+		breaker.probing = true
+		return nil
+	case circuitHalfOpen:
+		if breaker.probing {
+			return &CircuitOpenError{Service: service, RetryAt: *breaker.RetryAt}
+		}
+		breaker.probing = true
+	}
+	return nil
+}
+
+// Report records the outcome of a request to the service, err is nil if the request succeeded
+func (c *CircuitBreakers) Report(service string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	breaker, ok := c.breakers[service]
+	if !ok {
+		return
+	}
+	breaker.probing = false
+	if err == nil {
+		breaker.State = circuitClosed
+		breaker.Failures = 0
+		breaker.OpenedAt = nil
+		breaker.RetryAt = nil
+		return
+	}
+
+	breaker.Failures++
+	breaker.LastError = err.Error()
+	if breaker.State == circuitHalfOpen || breaker.Failures >= c.threshold {
+		openedAt := c.now()
+		retryAt := openedAt.Add(c.openDuration)
+		breaker.State = circuitOpen
+		breaker.OpenedAt = &openedAt
+		breaker.RetryAt = &retryAt
+	}
+}
+
+// States returns the circuit breakers of all services sorted by service
+func (c *CircuitBreakers) States() []CircuitBreaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	states := make([]CircuitBreaker, 0, len(c.breakers))
+	for _, breaker := range c.breakers {
+		states = append(states, *breaker)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Service < states[j].Service })
+	return states
+}
+
+// circuitService returns the service a request is sent to: the name of the registered method with the
+// path of the request, else the host and path prefix of the endpoint, so the detection methods and the
+// storage behind BASE_URL have separate circuit breakers
+func circuitService(u *url.URL) string {
+	if name, ok := methodRegistry.MethodAt(u.Path); ok {
+		return name
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	prefixLength := 3
+	if strings.HasPrefix(u.Path, endpointPostStartConceptDetection) {
+		prefixLength = 4
+	}
+	if len(segments) > prefixLength {
+		segments = segments[:prefixLength]
+	}
+	return u.Host + "/" + strings.Join(segments, "/")
+}
+
+// circuitBreakerTransport sends requests through the circuit breaker of their service
+type circuitBreakerTransport struct {
+	next     http.RoundTripper
+	breakers *CircuitBreakers
+}
+
+func (t *circuitBreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	service := circuitService(req.URL)
+	if err := t.breakers.Allow(service, req.URL.Host); err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, err
+	}
+	res, err := t.next.RoundTrip(req)
+	switch {
+	case err != nil:
+		t.breakers.Report(service, err)
+	case res.StatusCode == http.StatusBadGateway || res.StatusCode == http.StatusServiceUnavailable ||
+		res.StatusCode == http.StatusGatewayTimeout:
+		t.breakers.Report(service, fmt.Errorf("responded with status %d", res.StatusCode))
+	default:
+		t.breakers.Report(service, nil)
+	}
+	return res, err
+}
+
+// getStatus returns the circuit breaker state of every downstream service
+func getStatus(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"circuit_breakers": circuitBreakers.States()})
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	datasetModeKey        = "dataset_mode"
+	datasetModeCombined   = "combined"
+	datasetModePerDataset = "per_dataset"
+
+	comparisonMetricKey = "comparison"
+)
+
+// ConceptAlignment model, a concept and the datasets it was found in
+type ConceptAlignment struct {
+	Concept  string   `json:"concept"`
+	Datasets []string `json:"datasets"`
+}
+
+// TopicAlignment model, the most similar topic of another dataset for a topic
+type TopicAlignment struct {
+	Dataset      string  `json:"dataset"`
+	Topic        string  `json:"topic"`
+	OtherDataset string  `json:"other_dataset"`
+	OtherTopic   string  `json:"other_topic"`
+	Similarity   float64 `json:"similarity"`
+}
+
+// DatasetComparison model, aligns the concepts and topics that were detected separately per dataset
+type DatasetComparison struct {
+	Datasets       []string            `json:"datasets"`
+	Concepts       []ConceptAlignment  `json:"concepts"`
+	SharedConcepts []string            `json:"shared_concepts"`
+	UniqueConcepts map[string][]string `json:"unique_concepts"`
+	Topics         []TopicAlignment    `json:"topics"`
+}
+
+// _startPerDatasetDetection runs the method of the run separately on every dataset and stores a comparison in the parent result
+func _startPerDatasetDetection(parent *Result, template Run, datasets []Dataset) Result {
+	parent.Status = statusStarted
+	jobJournal.StartParent(*parent)
+	_ = storeResult(parent)
+
+	endResults := make([]Result, len(datasets))
+	var wg sync.WaitGroup
+	for i, dataset := range datasets {
+		child := new(Result)
+		child.Method = template.Method
+		child.DatasetName = dataset.Name
+		child.Status = statusScheduled
+		child.StartedAt = parent.StartedAt
+		child.Params = template.Params
+		child.Name = parent.Name + "/" + dataset.Name
+		child.Parent = parent.Name
+		child.Owner = parent.Owner
+		_ = storeResult(child)
+		run := template
+		run.Dataset = dataset
+
+		wg.Add(1)
+		go func(i int, child *Result, run Run) {
+			defer wg.Done()
+			endResults[i] = _startNewDetection(child, &run)
+		}(i, child, run)
+	}
+	wg.Wait()
+
+	parent.Status = statusFinished
+	var failedDatasets []string
+	for _, endResult := range endResults {
+		if endResult.Status != statusFinished {
+			logJob(*parent, "detection on dataset %s %s", endResult.DatasetName, endResult.Status)
+			failedDatasets = append(failedDatasets, endResult.DatasetName)
+		}
+	}
+	if len(failedDatasets) > 0 {
+		parent.fail(fmt.Errorf("detections not finished on datasets: %s", strings.Join(failedDatasets, ", ")), errorCategoryDependency)
+	}
+	if parent.Metrics == nil {
+		parent.Metrics = make(map[string]interface{})
+	}
+	parent.Metrics[comparisonMetricKey] = compareDatasetResults(endResults)
+	if err := storeResult(parent); !isInvalidTransition(err) {
+		notifyCallback(*parent)
+	}
+	return *parent
+}
+
+// compareDatasetResults aligns the concepts (by lemma) and topics (by jaccard similarity of their words) of the results
+func compareDatasetResults(results []Result) DatasetComparison {
+	comparison := DatasetComparison{UniqueConcepts: make(map[string][]string)}
+
+	conceptDatasets := make(map[string][]string)
+	conceptNames := make(map[string]string)
+	for _, result := range results {
+		comparison.Datasets = append(comparison.Datasets, result.DatasetName)
+		for _, concept := range predictedConcepts(result) {
+			key := conceptKey(concept)
+			if _, ok := conceptNames[key]; !ok {
+				conceptNames[key] = concept
+			}
+			conceptDatasets[key] = append(conceptDatasets[key], result.DatasetName)
+		}
+	}
+
+	keys := make([]string, 0, len(conceptDatasets))
+	for key := range conceptDatasets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		datasetNames := conceptDatasets[key]
+		comparison.Concepts = append(comparison.Concepts, ConceptAlignment{Concept: conceptNames[key], Datasets: datasetNames})
+		if len(datasetNames) == len(results) {
+			comparison.SharedConcepts = append(comparison.SharedConcepts, conceptNames[key])
+		} else if len(datasetNames) == 1 {
+			comparison.UniqueConcepts[datasetNames[0]] = append(comparison.UniqueConcepts[datasetNames[0]], conceptNames[key])
+		}
+	}
+
+	for i, result := range results {
+		topics := topicWords(result)
+		for j, other := range results {
+			if i == j {
+				continue
+			}
+			otherTopics := topicWords(other)
+			for _, topic := range sortedKeys(topics) {
+				best := TopicAlignment{Dataset: result.DatasetName, Topic: topic, OtherDataset: other.DatasetName}
+				for _, otherTopic := range sortedKeys(otherTopics) {
+					similarity := jaccard(topics[topic], otherTopics[otherTopic])
+					if similarity > best.Similarity {
+						best.OtherTopic = otherTopic
+						best.Similarity = similarity
+					}
+				}
+				if best.OtherTopic != "" {
+					comparison.Topics = append(comparison.Topics, best)
+				}
+			}
+		}
+	}
+	return comparison
+}
+
+// conceptKey is the lemma-normalized form of a concept used to align concepts
+func conceptKey(concept string) string {
+	return strings.Join(normalizeTokens(concept, true), " ")
+}
+
+// topicWords returns the lemma-normalized words of every topic of the result
+func topicWords(result Result) map[string][]string {
+	topics := rawTopicWords(result)
+	for topic, words := range topics {
+		for i, word := range words {
+			words[i] = conceptKey(word)
+		}
+		topics[topic] = words
+	}
+	return topics
+}
+
+// rawTopicWords returns the words of every topic of the result as the method returned them
+func rawTopicWords(result Result) map[string][]string {
+	topics := make(map[string][]string)
+	for topic, words := range result.Topics {
+		list, ok := words.([]interface{})
+		if !ok {
+			continue
+		}
+		for _, word := range list {
+			switch w := word.(type) {
+			case string:
+				topics[topic] = append(topics[topic], w)
+			case []interface{}:
+				// topic words with weights, e.g. ["word", 0.3]
+				if len(w) > 0 {
+					topics[topic] = append(topics[topic], fmt.Sprintf("%v", w[0]))
+				}
+			}
+		}
+	}
+	return topics
+}
+
+// jaccard returns the size of the intersection divided by the size of the union of both word sets
+func jaccard(a []string, b []string) float64 {
+	setA := make(map[string]bool)
+	for _, word := range a {
+		setA[word] = true
+	}
+	setB := make(map[string]bool)
+	for _, word := range b {
+		setB[word] = true
+	}
+	if len(setA) == 0 && len(setB) == 0 {
+		return 0
+	}
+	intersection := 0
+	for word := range setA {
+		if setB[word] {
+			intersection++
+		}
+	}
+	return float64(intersection) / float64(len(setA)+len(setB)-intersection)
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
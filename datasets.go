@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	datasetSeparator     = "#!#"
+	datasetFetchParallel = 4
+)
+
+// DatasetError model, describes why a single dataset could not be retrieved
+type DatasetError struct {
+	Dataset string `json:"dataset"`
+	Message string `json:"message"`
+	err     error
+}
+
+// DatasetFetchError is returned if at least one dataset could not be retrieved
+type DatasetFetchError struct {
+	Errors []DatasetError
+}
+
+func (e *DatasetFetchError) Error() string {
+	var messages []string
+	for _, datasetError := range e.Errors {
+		messages = append(messages, datasetError.Dataset+": "+datasetError.Message)
+	}
+	return "could not retrieve datasets: " + strings.Join(messages, "; ")
+}
+
+// DatasetErrorResponse model
+type DatasetErrorResponse struct {
+	Message string         `json:"message"`
+	Status  bool           `json:"status"`
+	Errors  []DatasetError `json:"errors"`
+}
+
+// fetchDatasets retrieves the datasets concurrently, at most datasetFetchParallel at a time.
+// The datasets are returned in the order of the names.
+func fetchDatasets(names []string) ([]Dataset, error) {
+	datasets := make([]Dataset, len(names))
+	errs := make([]error, len(names))
+
+	running := make(chan struct{}, datasetFetchParallel)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		running <- struct{}{}
+		go func(i int, name string) {
+			defer wg.Done()
+			defer func() { <-running }()
+			datasets[i], errs[i] = RESTGetDataset(name)
+		}(i, name)
+	}
+	wg.Wait()
+
+	fetchError := new(DatasetFetchError)
+	for i, err := range errs {
+		if err != nil {
+			fetchError.Errors = append(fetchError.Errors, DatasetError{Dataset: names[i], Message: err.Error(), err: err})
+		}
+	}
+	if len(fetchError.Errors) > 0 {
+		return datasets, fetchError
+	}
+	return datasets, nil
+}
+
+// getDatasets fetches the dataset, names separated by "#!#" are fetched and combined into one dataset
+func getDatasets(datasetName string) (Dataset, error) {
+	datasets, err := fetchDatasets(strings.Split(datasetName, datasetSeparator))
+	if err != nil {
+		return Dataset{Name: datasetName}, err
+	}
+	return combineDatasets(datasetName, datasets), nil
+}
+
+// combineDatasets concatenates the documents and ground truth of the datasets
+func combineDatasets(name string, datasets []Dataset) Dataset {
+	var combined Dataset
+	combined.Name = name
+	for _, dataset := range datasets {
+		combined.Documents = append(combined.Documents, dataset.Documents...)
+		combined.GroundTruth = append(combined.GroundTruth, dataset.GroundTruth...)
+	}
+	combined.Size = len(combined.Documents)
+	return combined
+}
+
+// respondWithDatasetError reports every dataset that could not be retrieved, with 404 if the storage
+// does not know any of them and 502 if the storage failed
+func respondWithDatasetError(w http.ResponseWriter, err error) {
+	fmt.Printf("ERROR retrieving datasets: %s\n", err)
+	response := DatasetErrorResponse{Status: false, Message: "ERROR retrieving datasets"}
+	if fetchError, ok := err.(*DatasetFetchError); ok {
+		response.Errors = fetchError.Errors
+	} else {
+		response.Errors = []DatasetError{{Message: err.Error(), err: err}}
+	}
+	status := http.StatusNotFound
+	for _, datasetError := range response.Errors {
+		var downstreamError *DownstreamError
+		if !errors.As(datasetError.err, &downstreamError) || downstreamError.StatusCode != http.StatusNotFound {
+			status = http.StatusBadGateway
+		}
+	}
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+)
+
+const dryRunKey = "dry_run"
+
+// DryRunRequest model, a request that would be sent to a method service. CachedFrom names the
+// finished result whose output would be reused instead of sending the request
+type DryRunRequest struct {
+	URL        string          `json:"url"`
+	Method     string          `json:"method"`
+	Payload    json.RawMessage `json:"payload"`
+	CachedFrom string          `json:"cached_from,omitempty"`
+}
+
+// DryRunResponse model, the requests a run would send
+type DryRunResponse struct {
+	Status   bool            `json:"status"`
+	Requests []DryRunRequest `json:"requests"`
+}
+
+func parseDryRun(body map[string]interface{}) (bool, *ParamError) {
+	return parseBoolParam(body, dryRunKey)
+}
+
+func newDryRunRequest(url string, requestBody *bytes.Buffer) DryRunRequest {
+	return DryRunRequest{URL: url, Method: POST, Payload: bytes.TrimSpace(requestBody.Bytes())}
+}
+
+// detectionDryRun returns the requests of the detection runs, one per batch if a run is chunked
+func detectionDryRun(runs []Run) DryRunResponse {
+	response := DryRunResponse{Status: true}
+	for _, run := range runs {
+		cachedFrom := ""
+		if cached, ok := resultCache.Lookup(runHash(run)); ok && !run.Force {
+			cachedFrom = cached.Name
+		}
+		batches := []Run{run}
+		if chunking := runChunking(run); chunking.BatchSize > 0 && len(run.Dataset.Documents) > chunking.BatchSize {
+			batches, _ = splitRun(run, chunking.BatchSize)
+		}
+		for _, batch := range batches {
+			request := newDryRunRequest(detectionRequest(batch))
+			request.CachedFrom = cachedFrom
+			response.Requests = append(response.Requests, request)
+		}
+	}
+	return response
+}
+
+func respondWithDryRun(w http.ResponseWriter, response DryRunResponse) {
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ensembleMethod        = "ensemble"
+	ensembleMetricKey     = "ensemble"
+	ensembleVote          = "vote"
+	ensembleWeightedUnion = "weighted_union"
+	ensembleMaxMembers    = 10
+)
+
+// EnsembleMember model, a method of an ensemble with its params and the weight of its votes
+type EnsembleMember struct {
+	Method string                 `json:"method"`
+	Params map[string]interface{} `json:"params"`
+	Weight float64                `json:"weight"`
+}
+
+// EnsembleRequest model, strategy is vote (default, concepts found by at least min_votes members,
+// default a majority) or weighted_union (concepts whose share of the total weight is at least min_weight)
+type EnsembleRequest struct {
+	Name        string           `json:"name"`
+	Dataset     string           `json:"dataset"`
+	Members     []EnsembleMember `json:"members"`
+	Strategy    string           `json:"strategy"`
+	MinVotes    int              `json:"min_votes"`
+	MinWeight   float64          `json:"min_weight"`
+	CallbackURL string           `json:"callback_url"`
+	Force       bool             `json:"force"`
+	Owner       string           `json:"owner"`
+}
+
+// EnsembleConcept model, the provenance of a merged code: the members that found it, its votes and weight share
+type EnsembleConcept struct {
+	Index   int      `json:"index"`
+	Name    string   `json:"name"`
+	Tore    string   `json:"tore"`
+	Members []string `json:"members"`
+	Votes   int      `json:"votes"`
+	Score   float64  `json:"score"`
+}
+
+// postStartEnsemble runs every member of the ensemble on the dataset and merges their codes
+func postStartEnsemble(w http.ResponseWriter, r *http.Request) {
+	var request EnsembleRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		fmt.Printf("ERROR decoding body: %s, body: %v\n", err, r.Body)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	fmt.Printf("postStartEnsemble called. Dataset: %v, Members: %d\n", request.Dataset, len(request.Members))
+
+	memberParams, paramErrors := validateEnsemble(&request)
+	if len(paramErrors) > 0 {
+		respondWithParamErrors(w, paramErrors)
+		return
+	}
+
+	dataset, err := getDatasets(request.Dataset)
+	if err != nil {
+		respondWithDatasetError(w, err)
+		return
+	}
+
+	parent := new(Result)
+	parent.Method = ensembleMethod
+	parent.DatasetName = dataset.Name
+	parent.Status = statusScheduled
+	parent.StartedAt = time.Now()
+	parent.Params = map[string]string{"strategy": request.Strategy}
+	parent.Name = request.Name
+	parent.CallbackURL = request.CallbackURL
+	parent.Owner = request.Owner
+
+	var members []*Result
+	for i, member := range request.Members {
+		result := new(Result)
+		result.Method = member.Method
+		result.DatasetName = dataset.Name
+		result.Status = statusScheduled
+		result.StartedAt = time.Now()
+		result.Params = memberParams[i]
+		result.Name = fmt.Sprintf("%s/member-%d", request.Name, i+1)
+		result.Parent = parent.Name
+		result.Owner = request.Owner
+		members = append(members, result)
+		parent.Children = append(parent.Children, result.Name)
+	}
+
+	if err = storeResult(parent); err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+	for _, result := range members {
+		if err = storeResult(result); err != nil {
+			respondWithStoreError(w, err)
+			return
+		}
+	}
+
+	scheduled := *parent
+
+	go _runEnsemble(parent, members, request, dataset)
+
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(scheduled)
+}
+
+// validateEnsemble applies the defaults of the request and returns the validated params of every member
+func validateEnsemble(request *EnsembleRequest) ([]map[string]string, []ParamError) {
+	var paramErrors []ParamError
+	if request.Name == "" {
+		paramErrors = append(paramErrors, ParamError{Field: "name", Message: "parameter is required"})
+	}
+	if request.Dataset == "" {
+		paramErrors = append(paramErrors, ParamError{Field: "dataset", Message: "parameter is required"})
+	}
+	if callbackErr := validateCallbackURL(request.CallbackURL); callbackErr != nil {
+		paramErrors = append(paramErrors, *callbackErr)
+	}
+	if len(request.Members) < 2 || len(request.Members) > ensembleMaxMembers {
+		paramErrors = append(paramErrors, ParamError{Field: "members", Message: fmt.Sprintf("must have 2 to %d members", ensembleMaxMembers)})
+	}
+	if request.Strategy == "" {
+		request.Strategy = ensembleVote
+	}
+	if request.Strategy != ensembleVote && request.Strategy != ensembleWeightedUnion {
+		paramErrors = append(paramErrors, ParamError{Field: "strategy", Message: "must be vote or weighted_union"})
+	}
+	if request.MinVotes == 0 {
+		request.MinVotes = len(request.Members)/2 + 1
+	}
+	if request.MinVotes < 0 || request.MinVotes > len(request.Members) {
+		paramErrors = append(paramErrors, ParamError{Field: "min_votes", Message: "must be between 1 and the number of members"})
+	}
+	if request.MinWeight < 0 || request.MinWeight > 1 {
+		paramErrors = append(paramErrors, ParamError{Field: "min_weight", Message: "must be between 0 and 1"})
+	}
+
+	var memberParams []map[string]string
+	for i := range request.Members {
+		member := &request.Members[i]
+		if member.Method == "" {
+			paramErrors = append(paramErrors, ParamError{Field: fmt.Sprintf("members[%d].method", i), Message: "parameter is required"})
+		}
+		if member.Weight == 0 {
+			member.Weight = 1
+		}
+		if member.Weight < 0 {
+			paramErrors = append(paramErrors, ParamError{Field: fmt.Sprintf("members[%d].weight", i), Message: "must be > 0"})
+		}
+		validated, memberErrors := methodRegistry.Resolve(member.Method).Params.Validate(member.Params)
+		for _, memberError := range memberErrors {
+			paramErrors = append(paramErrors, ParamError{Field: fmt.Sprintf("members[%d].%s", i, memberError.Field), Message: memberError.Message})
+		}
+		memberParams = append(memberParams, stringifyParams(validated))
+	}
+	return memberParams, paramErrors
+}
+
+func _runEnsemble(parent *Result, members []*Result, request EnsembleRequest, dataset Dataset) {
+	parent.Status = statusStarted
+	jobJournal.StartParent(*parent)
+	_ = storeResult(parent)
+
+	endResults := make([]Result, len(members))
+	var wg sync.WaitGroup
+	for i, result := range members {
+		wg.Add(1)
+		go func(i int, result *Result) {
+			defer wg.Done()
+			run := &Run{Method: result.Method, Params: result.Params, Dataset: dataset, Force: request.Force}
+			endResults[i] = _startNewDetection(result, run)
+		}(i, result)
+	}
+	wg.Wait()
+
+	var failedMembers []string
+	for _, endResult := range endResults {
+		if endResult.Status != statusFinished {
+			logJob(*parent, "member %s %s", endResult.Name, endResult.Status)
+			failedMembers = append(failedMembers, endResult.Name)
+		}
+	}
+	if len(failedMembers) > 0 {
+		parent.fail(fmt.Errorf("members not finished: %s", strings.Join(failedMembers, ", ")), errorCategoryDependency)
+	} else {
+		parent.Status = statusFinished
+		codes, concepts := mergeEnsembleCodes(endResults, request)
+		parent.Codes = codes
+		parent.Metrics = map[string]interface{}{ensembleMetricKey: concepts}
+		logJob(*parent, "merged %d codes of %d members", len(codes), len(members))
+	}
+	if err := storeResult(parent); !isInvalidTransition(err) {
+		notifyCallback(*parent)
+	}
+}
+
+// mergeEnsembleCodes merges the codes of the members by the strategy of the request. Codes are aligned
+// by their lemma-normalized name and tore, the code of the first member that found it is kept.
+func mergeEnsembleCodes(results []Result, request EnsembleRequest) ([]Code, []EnsembleConcept) {
+	totalWeight := 0.0
+	for _, member := range request.Members {
+		totalWeight += member.Weight
+	}
+
+	var keys []string
+	codes := make(map[string]Code)
+	concepts := make(map[string]*EnsembleConcept)
+	for i, result := range results {
+		found := make(map[string]bool)
+		for _, code := range result.Codes {
+			key := conceptKey(code.Name) + "\x00" + code.Tore
+			if found[key] {
+				continue
+			}
+			found[key] = true
+			concept, ok := concepts[key]
+			if !ok {
+				concept = &EnsembleConcept{Name: code.Name, Tore: code.Tore}
+				concepts[key] = concept
+				codes[key] = code
+				keys = append(keys, key)
+			}
+			concept.Members = append(concept.Members, result.Name)
+			concept.Votes++
+			if totalWeight > 0 {
+				concept.Score += request.Members[i].Weight / totalWeight
+			}
+		}
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool { return concepts[keys[i]].Score > concepts[keys[j]].Score })
+	var merged []Code
+	var provenance []EnsembleConcept
+	for _, key := range keys {
+		concept := concepts[key]
+		if request.Strategy == ensembleVote && concept.Votes < request.MinVotes {
+			continue
+		}
+		if request.Strategy == ensembleWeightedUnion && concept.Score+1e-9 < request.MinWeight {
+			continue
+		}
+		code := codes[key]
+		index := len(merged)
+		code.Index = &index
+		concept.Index = index
+		merged = append(merged, code)
+		provenance = append(provenance, *concept)
+	}
+	return merged, provenance
+}
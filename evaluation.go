@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	matchExact = "exact"
+	matchLemma = "lemma"
+	matchFuzzy = "fuzzy"
+
+	fuzzyMatchThreshold = 0.8
+	evaluationMetricKey = "evaluation"
+)
+
+var matchModes = []string{matchExact, matchLemma, matchFuzzy}
+
+// Scores model, precision, recall and f1 of a set of predicted concepts
+type Scores struct {
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	F1        float64 `json:"f1"`
+	Matched   int     `json:"matched"`
+	Predicted int     `json:"predicted"`
+	Truth     int     `json:"truth"`
+}
+
+// Evaluation model, scores per match mode, overall and per document
+type Evaluation struct {
+	Overall   map[string]Scores            `json:"overall"`
+	Documents map[string]map[string]Scores `json:"documents"`
+}
+
+// postEvaluateResult evaluates a stored result against the ground truth of its dataset and stores the metrics
+func postEvaluateResult(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		fmt.Printf("ERROR decoding body: %s, body: %v\n", err, r.Body)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	resultName, _ := body["result"].(string)
+	if resultName == "" {
+		respondWithParamErrors(w, []ParamError{{Field: "result", Message: "parameter is required"}})
+		return
+	}
+	fmt.Printf("postEvaluateResult called. Result: %v\n", resultName)
+
+	result, err := RESTGetResult(resultName)
+	handleErrorWithResponse(w, err, "ERROR retrieving result")
+	resultStates.load(result)
+	if resultStates.status(result.Name) != statusFinished {
+		w.Header().Set(contentTypeKey, contentTypeValJSON)
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(ResponseMessage{Status: false, Message: "Result is not finished"})
+		return
+	}
+
+	datasetName, _ := body["dataset"].(string)
+	if datasetName == "" {
+		datasetName = result.DatasetName
+	}
+	dataset, err := getDatasets(datasetName)
+	if err != nil {
+		respondWithDatasetError(w, err)
+		return
+	}
+
+	if len(dataset.GroundTruth) == 0 {
+		w.Header().Set(contentTypeKey, contentTypeValJSON)
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(ResponseMessage{Status: false, Message: "Dataset has no ground truth."})
+		return
+	}
+
+	evaluation := evaluateResult(result, dataset)
+	if result.Metrics == nil {
+		result.Metrics = make(map[string]interface{})
+	}
+	result.Metrics[evaluationMetricKey] = evaluation
+	if err = storeResult(&result); err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(evaluation)
+}
+
+// evaluateResult compares the concepts of the result with the ground truth of the dataset.
+// Ground truth elements without id are only used for the overall scores. The predicted concepts
+// of a document are the concepts of the result whose lemmas occur in its text.
+func evaluateResult(result Result, dataset Dataset) Evaluation {
+	predicted := predictedConcepts(result)
+	var truth []string
+	truthByDocument := make(map[string][]string)
+	for _, element := range dataset.GroundTruth {
+		if strings.TrimSpace(element.Value) == "" {
+			continue
+		}
+		truth = append(truth, element.Value)
+		if element.Id != "" {
+			truthByDocument[element.Id] = append(truthByDocument[element.Id], element.Value)
+		}
+	}
+
+	evaluation := Evaluation{
+		Overall:   make(map[string]Scores),
+		Documents: make(map[string]map[string]Scores),
+	}
+	for _, mode := range matchModes {
+		evaluation.Overall[mode] = scoreConcepts(predicted, uniqueConcepts(truth), mode)
+	}
+
+	for _, document := range dataset.Documents {
+		documentTruth, ok := truthByDocument[document.Id]
+		if !ok {
+			continue
+		}
+		text := " " + strings.Join(normalizeTokens(document.Text, true), " ") + " "
+		var documentPredicted []string
+		for _, concept := range predicted {
+			if strings.Contains(text, " "+strings.Join(normalizeTokens(concept, true), " ")+" ") {
+				documentPredicted = append(documentPredicted, concept)
+			}
+		}
+		evaluation.Documents[document.Id] = make(map[string]Scores)
+		for _, mode := range matchModes {
+			evaluation.Documents[document.Id][mode] = scoreConcepts(documentPredicted, uniqueConcepts(documentTruth), mode)
+		}
+	}
+	return evaluation
+}
+
+// predictedConcepts returns the code names of the result, or the topic words if there are no codes
+func predictedConcepts(result Result) []string {
+	var concepts []string
+	for _, code := range result.Codes {
+		concepts = append(concepts, code.Name)
+	}
+	if len(concepts) == 0 {
+		for _, words := range rawTopicWords(result) {
+			concepts = append(concepts, words...)
+		}
+	}
+	return uniqueConcepts(concepts)
+}
+
+func uniqueConcepts(concepts []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, concept := range concepts {
+		key := strings.Join(normalizeTokens(concept, false), " ")
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, concept)
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// scoreConcepts matches every truth concept to at most one predicted concept
+func scoreConcepts(predicted []string, truth []string, mode string) Scores {
+	scores := Scores{Predicted: len(predicted), Truth: len(truth)}
+	used := make([]bool, len(predicted))
+	for _, t := range truth {
+		for i, p := range predicted {
+			if !used[i] && conceptsMatch(p, t, mode) {
+				used[i] = true
+				scores.Matched++
+				break
+			}
+		}
+	}
+	if scores.Predicted > 0 {
+		scores.Precision = float64(scores.Matched) / float64(scores.Predicted)
+	}
+	if scores.Truth > 0 {
+		scores.Recall = float64(scores.Matched) / float64(scores.Truth)
+	}
+	if scores.Precision+scores.Recall > 0 {
+		scores.F1 = 2 * scores.Precision * scores.Recall / (scores.Precision + scores.Recall)
+	}
+	return scores
+}
+
+func conceptsMatch(a string, b string, mode string) bool {
+	switch mode {
+	case matchExact:
+		return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+	case matchLemma:
+		return strings.Join(normalizeTokens(a, true), " ") == strings.Join(normalizeTokens(b, true), " ")
+	case matchFuzzy:
+		return similarity(strings.Join(normalizeTokens(a, true), " "), strings.Join(normalizeTokens(b, true), " ")) >= fuzzyMatchThreshold
+	}
+	return false
+}
+
+// normalizeTokens lowercases s, splits it at non letters/digits and optionally reduces the tokens to their lemma
+func normalizeTokens(s string, lemmatize bool) []string {
+	tokens := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if lemmatize {
+		for i, token := range tokens {
+			tokens[i] = lemma(token)
+		}
+	}
+	return tokens
+}
+
+// lemma is a light-weight english lemmatizer that removes common inflection suffixes
+func lemma(token string) string {
+	switch {
+	case len(token) > 4 && strings.HasSuffix(token, "ies"):
+		return token[:len(token)-3] + "y"
+	case len(token) > 5 && strings.HasSuffix(token, "ing"):
+		return token[:len(token)-3]
+	case len(token) > 4 && strings.HasSuffix(token, "ed"):
+		return token[:len(token)-2]
+	case len(token) > 4 && (strings.HasSuffix(token, "ses") || strings.HasSuffix(token, "xes") ||
+		strings.HasSuffix(token, "ches") || strings.HasSuffix(token, "shes")):
+		return token[:len(token)-2]
+	case len(token) > 3 && strings.HasSuffix(token, "s") && !strings.HasSuffix(token, "ss"):
+		return token[:len(token)-1]
+	}
+	return token
+}
+
+// similarity returns 1 - levenshtein distance / length of the longer string
+func similarity(a string, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	longer := len(ra)
+	if len(rb) > longer {
+		longer = len(rb)
+	}
+	return 1 - float64(previous[len(rb)])/float64(longer)
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
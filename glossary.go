@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultGlossariesFile = "glossaries.json"
+
+	glossaryKey     = "glossary"
+	flagGlossaryKey = "flag_glossary"
+
+	glossaryCorrectionsKey = "glossary_corrections"
+)
+
+// GlossaryRequest model, creates or replaces the glossary with the given name
+type GlossaryRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Terms       []string `json:"terms"`
+}
+
+// Glossary model, domain terms (app names, feature names, jargon) the spellchecker must not correct
+type Glossary struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Terms       []string  `json:"terms"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// GlossaryCorrection model, a corrected document whose corrections touched glossary terms
+type GlossaryCorrection struct {
+	Id     string   `json:"id"`
+	Terms  []string `json:"terms"`
+	Marked string   `json:"marked"`
+}
+
+// GlossaryStore holds all glossaries and writes them to its file on every change
+type GlossaryStore struct {
+	mu         sync.Mutex
+	file       jsonFile
+	glossaries map[string]*Glossary
+}
+
+// glossaries is replaced by the persistent store in main
+var glossaries = &GlossaryStore{glossaries: make(map[string]*Glossary)}
+
+func glossariesPath() string {
+	path := os.Getenv("GLOSSARIES_FILE")
+	if path == "" {
+		pwd, _ := os.Getwd()
+		path = pwd + "/" + defaultGlossariesFile
+	}
+	return path
+}
+
+func loadGlossaries(path string) *GlossaryStore {
+	store := &GlossaryStore{file: jsonFile{path: path, kind: "glossaries"}, glossaries: make(map[string]*Glossary)}
+	var list []*Glossary
+	store.file.load(&list)
+	for _, glossary := range list {
+		store.glossaries[glossary.Name] = glossary
+	}
+	log.Printf("Loaded %d glossaries from %s\n", len(list), path)
+	return store
+}
+
+// Put adds or replaces a glossary, a replaced glossary keeps its creation time
+func (s *GlossaryStore) Put(glossary Glossary) Glossary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.glossaries[glossary.Name]; ok {
+		glossary.CreatedAt = existing.CreatedAt
+	}
+	s.glossaries[glossary.Name] = &glossary
+	s.save()
+	return glossary
+}
+
+// Get returns a copy of the glossary
+func (s *GlossaryStore) Get(name string) (Glossary, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	glossary, ok := s.glossaries[name]
+	if !ok {
+		return Glossary{}, false
+	}
+	return *glossary, true
+}
+
+// Delete removes a glossary and reports whether it existed
+func (s *GlossaryStore) Delete(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.glossaries[name]; !ok {
+		return false
+	}
+	delete(s.glossaries, name)
+	s.save()
+	return true
+}
+
+// List returns all glossaries sorted by name
+func (s *GlossaryStore) List() []Glossary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Glossary, 0, len(s.glossaries))
+	for _, glossary := range s.glossaries {
+		list = append(list, *glossary)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// save requires the lock
+func (s *GlossaryStore) save() {
+	list := make([]*Glossary, 0, len(s.glossaries))
+	for _, glossary := range s.glossaries {
+		list = append(list, glossary)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	s.file.save(list)
+}
+
+// newGlossary validates the request, the terms are trimmed, deduplicated case-insensitively and sorted
+func newGlossary(request GlossaryRequest, now time.Time) (Glossary, []ParamError) {
+	var paramErrors []ParamError
+	if request.Name == "" {
+		paramErrors = append(paramErrors, ParamError{Field: "name", Message: "parameter is required"})
+	}
+
+	var terms []string
+	seen := make(map[string]bool)
+	for i, term := range request.Terms {
+		term = strings.Join(strings.Fields(term), " ")
+		if term == "" {
+			paramErrors = append(paramErrors, ParamError{Field: fmt.Sprintf("terms[%d]", i), Message: "term is empty"})
+			continue
+		}
+		if key := strings.ToLower(term); !seen[key] {
+			seen[key] = true
+			terms = append(terms, term)
+		}
+	}
+	if len(request.Terms) == 0 {
+		paramErrors = append(paramErrors, ParamError{Field: "terms", Message: "parameter is required"})
+	}
+	if len(paramErrors) > 0 {
+		return Glossary{}, paramErrors
+	}
+	sort.Strings(terms)
+
+	return Glossary{
+		Name:        request.Name,
+		Description: request.Description,
+		Terms:       terms,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, nil
+}
+
+// parseGlossary returns the terms of the glossary named in the body and whether touched terms are flagged
+func parseGlossary(body map[string]interface{}) ([]string, bool, []ParamError) {
+	var paramErrors []ParamError
+	flag, flagErr := parseBoolParam(body, flagGlossaryKey)
+	if flagErr != nil {
+		paramErrors = append(paramErrors, *flagErr)
+	}
+
+	value, ok := body[glossaryKey]
+	if !ok {
+		if flag {
+			paramErrors = append(paramErrors, ParamError{Field: flagGlossaryKey, Message: "requires glossary"})
+		}
+		return nil, false, paramErrors
+	}
+	name, _ := value.(string)
+	glossary, found := glossaries.Get(name)
+	if !found {
+		paramErrors = append(paramErrors, ParamError{Field: glossaryKey, Message: fmt.Sprintf("unknown glossary %v", value)})
+		return nil, false, paramErrors
+	}
+	return glossary.Terms, flag, paramErrors
+}
+
+// normalizeToken lower-cases the token and trims the punctuation around it
+func normalizeToken(token string) string {
+	return strings.ToLower(strings.TrimFunc(token, func(r rune) bool { return unicode.IsPunct(r) || unicode.IsSymbol(r) }))
+}
+
+// markGlossaryChanges flags the changes that touch an occurrence of a term in the original tokens
+// and returns the touched terms
+func markGlossaryChanges(original []string, changes []TokenChange, terms []string) []string {
+	normalized := make([]string, len(original))
+	for i, token := range original {
+		normalized[i] = normalizeToken(token)
+	}
+
+	var touched []string
+	for _, term := range terms {
+		termTokens := strings.Fields(term)
+		for i := range termTokens {
+			termTokens[i] = normalizeToken(termTokens[i])
+		}
+		touchedTerm := false
+		for start := 0; start+len(termTokens) <= len(normalized); start++ {
+			if !tokensEqual(normalized[start:start+len(termTokens)], termTokens) {
+				continue
+			}
+			end := start + len(termTokens)
+			for i, change := range changes {
+				changed := len(strings.Fields(change.Original))
+				overlaps := change.Position < end && change.Position+changed > start
+				insideInsert := changed == 0 && change.Position > start && change.Position < end
+				if overlaps || insideInsert {
+					changes[i].Glossary = true
+					touchedTerm = true
+				}
+			}
+		}
+		if touchedTerm {
+			touched = append(touched, term)
+		}
+	}
+	return touched
+}
+
+func tokensEqual(a []string, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// flagGlossaryCorrections adds the documents whose corrections touched glossary terms to the response
+// of the spellchecker, if it answered with the corrected documents
+func flagGlossaryCorrections(run Run, message map[string]interface{}) map[string]interface{} {
+	corrected, ok := correctedDocuments(message)
+	if !ok {
+		fmt.Printf("spellchecker returned no corrected documents, glossary corrections are not flagged\n")
+		return message
+	}
+	flagged := []GlossaryCorrection{}
+	for _, diff := range newSpellcheckPreview("", "", run.Dataset, corrected, run.ProtectedTerms).Documents {
+		if len(diff.GlossaryTerms) > 0 {
+			flagged = append(flagged, GlossaryCorrection{Id: diff.Id, Terms: diff.GlossaryTerms, Marked: diff.Marked})
+		}
+	}
+	message[glossaryCorrectionsKey] = flagged
+	return message
+}
+
+// postGlossary creates or replaces a glossary
+func postGlossary(w http.ResponseWriter, r *http.Request) {
+	var request GlossaryRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		fmt.Printf("ERROR decoding body: %s, body: %v\n", err, r.Body)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	fmt.Printf("postGlossary called. Name: %v, Terms: %d\n", request.Name, len(request.Terms))
+
+	glossary, paramErrors := newGlossary(request, time.Now())
+	if len(paramErrors) > 0 {
+		respondWithParamErrors(w, paramErrors)
+		return
+	}
+	glossary = glossaries.Put(glossary)
+
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(glossary)
+}
+
+// getGlossaries lists all glossaries with their terms
+func getGlossaries(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(glossaries.List())
+}
+
+// deleteGlossary removes a glossary, spellcheckings that already started keep its terms
+func deleteGlossary(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	if !glossaries.Delete(name) {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(ResponseMessage{Status: false, Message: "Glossary not found"})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(ResponseMessage{Status: true, Message: "Glossary deleted"})
+}
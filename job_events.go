@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	jobEventStatus = "status"
+	jobEventLog    = "log"
+
+	jobEventBufferSize      = 64
+	jobEventHeartbeat       = 15 * time.Second
+	jobEventStatusRetention = 24 * time.Hour
+)
+
+// JobEvent model, a status transition or log line of a job
+type JobEvent struct {
+	ID      uint64    `json:"id"`
+	Type    string    `json:"type"`
+	Job     string    `json:"job"`
+	Method  string    `json:"method,omitempty"`
+	Status  string    `json:"status,omitempty"`
+	Message string    `json:"message,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// JobEventBroker fans out job events to all subscribed event streams
+type JobEventBroker struct {
+	mu          sync.Mutex
+	nextID      uint64
+	subscribers map[chan JobEvent]string
+	lastStatus  map[string]JobEvent
+}
+
+var jobEvents = newJobEventBroker()
+
+func newJobEventBroker() *JobEventBroker {
+	return &JobEventBroker{
+		subscribers: make(map[chan JobEvent]string),
+		lastStatus:  make(map[string]JobEvent),
+	}
+}
+
+// Subscribe returns a channel with the events of the given job, "" subscribes to all jobs.
+// The current status of the matching jobs is returned so that late subscribers are up to date.
+func (b *JobEventBroker) Subscribe(job string) (chan JobEvent, []JobEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	events := make(chan JobEvent, jobEventBufferSize)
+	b.subscribers[events] = job
+
+	var current []JobEvent
+	for name, event := range b.lastStatus {
+		if job == "" || job == name {
+			current = append(current, event)
+		}
+	}
+	return events, current
+}
+
+// Unsubscribe removes the channel from the broker and closes it
+func (b *JobEventBroker) Unsubscribe(events chan JobEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[events]; ok {
+		delete(b.subscribers, events)
+		close(events)
+	}
+}
+
+// Publish sends the event to all matching subscribers, slow subscribers miss events instead of blocking jobs
+func (b *JobEventBroker) Publish(event JobEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	event.ID = b.nextID
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	if event.Type == jobEventStatus {
+		b.lastStatus[event.Job] = event
+		for name, last := range b.lastStatus {
+			if time.Since(last.Time) > jobEventStatusRetention {
+				delete(b.lastStatus, name)
+			}
+		}
+	}
+
+	for events, job := range b.subscribers {
+		if job != "" && job != event.Job {
+			continue
+		}
+		select {
+		case events <- event:
+		default:
+			log.Printf("ERR job event stream is full, dropping event %d\n", event.ID)
+		}
+	}
+}
+
+// logJob logs the message and publishes it to the job event streams
+func logJob(result Result, format string, v ...interface{}) {
+	message := fmt.Sprintf(format, v...)
+	log.Printf("%s: %s\n", result.Name, message)
+	jobEvents.Publish(JobEvent{Type: jobEventLog, Job: result.Name, Method: result.Method, Message: message})
+}
+
+// getJobEvents streams status transitions and log lines as server-sent events, optionally filtered by ?job=<name>
+func getJobEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	job := r.URL.Query().Get("job")
+
+	w.Header().Set(contentTypeKey, "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	events, current := jobEvents.Subscribe(job)
+	defer jobEvents.Unsubscribe(events)
+
+	for _, event := range current {
+		writeJobEvent(w, event)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(jobEventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			writeJobEvent(w, event)
+			flusher.Flush()
+		case <-heartbeat.C:
+			_, _ = fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func writeJobEvent(w http.ResponseWriter, event JobEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf(errJsonMessageTemplate, err)
+		return
+	}
+	_, _ = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJobJournalFile = "jobs.journal"
+
+	journalStarted = "started"
+	journalEnded   = "ended"
+
+	jobKindDetection = "detection"
+	jobKindParent    = "parent"
+	jobKindTask      = "task"
+
+	jobRecoveryResume = "resume"
+	jobRecoveryFail   = "fail"
+)
+
+// JournalEntry model, a line of the job journal
+type JournalEntry struct {
+	Event       string            `json:"event"`
+	Kind        string            `json:"kind,omitempty"`
+	Name        string            `json:"name"`
+	Status      string            `json:"status,omitempty"`
+	Method      string            `json:"method,omitempty"`
+	Dataset     string            `json:"dataset,omitempty"`
+	Params      map[string]string `json:"params,omitempty"`
+	ChunkSize   int               `json:"chunk_size,omitempty"`
+	Force       bool              `json:"force,omitempty"`
+	CallbackURL string            `json:"callback_url,omitempty"`
+	Parent      string            `json:"parent,omitempty"`
+	Children    []string          `json:"children,omitempty"`
+	Owner       string            `json:"owner,omitempty"`
+	Attempts    int               `json:"attempts,omitempty"`
+	StartedAt   time.Time         `json:"started_at,omitempty"`
+	Time        time.Time         `json:"time"`
+}
+
+// JobJournal is an append-only file of started and ended jobs, it is used to find
+// the jobs that were interrupted by a restart of the orchestrator
+type JobJournal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// jobJournal is replaced by the persistent journal in main, the default journal does not write anything
+var jobJournal = &JobJournal{}
+
+func jobJournalPath() string {
+	path := os.Getenv("JOB_JOURNAL_FILE")
+	if path == "" {
+		pwd, _ := os.Getwd()
+		path = pwd + "/" + defaultJobJournalFile
+	}
+	return path
+}
+
+func jobRecoveryMode() string {
+	if os.Getenv("JOB_RECOVERY") == jobRecoveryFail {
+		return jobRecoveryFail
+	}
+	return jobRecoveryResume
+}
+
+// readJobJournal returns the last entry of every job whose last event is started
+func readJobJournal(path string) ([]JournalEntry, map[string]bool, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	last := make(map[string]JournalEntry)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry JournalEntry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// a line may be incomplete if the orchestrator died while writing it
+			continue
+		}
+		last[entry.Name] = entry
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var pending []JournalEntry
+	ended := make(map[string]bool)
+	for name, entry := range last {
+		if entry.Event == journalStarted {
+			pending = append(pending, entry)
+		} else {
+			ended[name] = true
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Name < pending[j].Name })
+	return pending, ended, nil
+}
+
+// openJobJournal truncates the journal at path and opens it for appending
+func openJobJournal(path string) *JobJournal {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Fatalf("ERR opening job journal %s: %v\n", path, err)
+	}
+	return &JobJournal{file: file}
+}
+
+func (j *JobJournal) record(entry JournalEntry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return
+	}
+	entry.Time = time.Now()
+	line, _ := json.Marshal(entry)
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		log.Printf("ERR writing job journal: %v\n", err)
+		return
+	}
+	_ = j.file.Sync()
+}
+
+// StartDetection records a detection with everything needed to resume it
+func (j *JobJournal) StartDetection(result Result, run Run) {
+	j.record(JournalEntry{
+		Event:       journalStarted,
+		Kind:        jobKindDetection,
+		Name:        result.Name,
+		Method:      run.Method,
+		Dataset:     run.Dataset.Name,
+		Params:      run.Params,
+		ChunkSize:   run.ChunkSize,
+		Force:       run.Force,
+		CallbackURL: result.CallbackURL,
+		Parent:      result.Parent,
+		Owner:       result.Owner,
+		Attempts:    result.Attempts,
+		StartedAt:   result.StartedAt,
+	})
+}
+
+// StartParent records a job that runs child results, e.g. a sweep or pipeline
+func (j *JobJournal) StartParent(result Result) {
+	j.record(JournalEntry{
+		Event:       journalStarted,
+		Kind:        jobKindParent,
+		Name:        result.Name,
+		Method:      result.Method,
+		Dataset:     result.DatasetName,
+		Params:      result.Params,
+		CallbackURL: result.CallbackURL,
+		Children:    result.Children,
+		Owner:       result.Owner,
+		StartedAt:   result.StartedAt,
+	})
+}
+
+// StartTask records a relevance classification or spellchecking, they are not resumed after a restart
+// because the service may already have created the new dataset or annotation
+func (j *JobJournal) StartTask(result Result) {
+	j.record(JournalEntry{
+		Event:       journalStarted,
+		Kind:        jobKindTask,
+		Name:        result.Name,
+		Method:      result.Method,
+		Dataset:     result.DatasetName,
+		Params:      result.Params,
+		CallbackURL: result.CallbackURL,
+		Owner:       result.Owner,
+		Attempts:    result.Attempts,
+		StartedAt:   result.StartedAt,
+	})
+}
+
+// End records that a job finished or failed
+func (j *JobJournal) End(result Result) {
+	j.record(JournalEntry{Event: journalEnded, Name: result.Name, Status: result.Status})
+}
+
+// Requeue records a started job of a previous process again, so it is reconciled on the next start
+func (j *JobJournal) Requeue(entry JournalEntry) {
+	entry.Event = journalStarted
+	j.record(entry)
+}
+
+// reconcileJobs resumes the interrupted detections or marks them failed and returns the names of both.
+// Detections of a parent job and the parent jobs themselves are always marked failed.
+// Jobs whose failed status could not be stored are returned as unresolved.
+func reconcileJobs(pending []JournalEntry, ended map[string]bool, mode string) (resumed []string, failed []string, unresolved []JournalEntry) {
+	isFailed := make(map[string]bool)
+	fail := func(entry JournalEntry, reason string) {
+		if isFailed[entry.Name] || ended[entry.Name] {
+			return
+		}
+		isFailed[entry.Name] = true
+		result := Result{
+			Method:      entry.Method,
+			Status:      statusFailed,
+			StartedAt:   entry.StartedAt,
+			DatasetName: entry.Dataset,
+			Params:      entry.Params,
+			Name:        entry.Name,
+			Parent:      entry.Parent,
+			Children:    entry.Children,
+			Owner:       entry.Owner,
+			CallbackURL: entry.CallbackURL,
+			Error:       &ResultError{Message: reason, Category: errorCategoryRestart},
+		}
+		logJob(result, "marking job failed: %s", reason)
+		if err := storeResult(&result); err != nil && !isInvalidTransition(err) {
+			logJob(result, "ERROR storing the failed status, the job is reconciled again on the next start: %s", err)
+			unresolved = append(unresolved, entry)
+			return
+		}
+		failed = append(failed, entry.Name)
+		notifyCallback(result)
+	}
+
+	for _, entry := range pending {
+		switch {
+		case entry.Kind == jobKindParent:
+			fail(entry, "orchestrator restarted while the job was running")
+			for _, child := range entry.Children {
+				fail(JournalEntry{Name: child, Method: entry.Method, Dataset: entry.Dataset, Parent: entry.Name, Owner: entry.Owner, StartedAt: entry.StartedAt},
+					"orchestrator restarted while the parent job was running")
+			}
+		case entry.Parent != "":
+			fail(entry, "orchestrator restarted while the parent job was running")
+		case entry.Kind == jobKindTask:
+			fail(entry, "orchestrator restarted while the job was running")
+		case mode != jobRecoveryResume:
+			fail(entry, "orchestrator restarted while the job was running")
+		default:
+			dataset, err := getDatasets(entry.Dataset)
+			if err != nil {
+				fail(entry, fmt.Sprintf("orchestrator restarted, job could not be resumed: %s", err))
+				continue
+			}
+			result := &Result{
+				Method:      entry.Method,
+				Status:      statusScheduled,
+				StartedAt:   entry.StartedAt,
+				DatasetName: entry.Dataset,
+				Params:      entry.Params,
+				Name:        entry.Name,
+				Owner:       entry.Owner,
+				CallbackURL: entry.CallbackURL,
+				Attempts:    entry.Attempts,
+			}
+			run := &Run{Method: entry.Method, Params: entry.Params, Dataset: dataset, ChunkSize: entry.ChunkSize, Force: entry.Force}
+			logJob(*result, "resuming job interrupted by a restart of the orchestrator")
+			resumed = append(resumed, entry.Name)
+			go _startNewDetection(result, run)
+		}
+	}
+	return resumed, failed, unresolved
+}
+
+// recoverJobs reconciles the jobs of the journal at path and continues with a compacted journal.
+// The old journal is only replaced once every interrupted job is resumed, failed or recorded again.
+func recoverJobs(path string) {
+	pending, ended, err := readJobJournal(path)
+	if err != nil {
+		log.Fatalf("ERR reading job journal %s: %v\n", path, err)
+	}
+	compacted := path + ".new"
+	jobJournal = openJobJournal(compacted)
+	resumed, failed, unresolved := reconcileJobs(pending, ended, jobRecoveryMode())
+	for _, entry := range unresolved {
+		jobJournal.Requeue(entry)
+	}
+	if err = os.Rename(compacted, path); err != nil {
+		log.Fatalf("ERR replacing job journal %s: %v\n", path, err)
+	}
+	if len(pending) > 0 {
+		log.Printf("Resumed %d, failed %d and kept %d interrupted jobs\n", len(resumed), len(failed), len(unresolved))
+	}
+}
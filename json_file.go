@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// jsonFile is a list persisted as JSON, stores with an empty path are not written to disk
+type jsonFile struct {
+	path string
+	kind string
+}
+
+// load decodes the file into list, a missing file leaves list empty
+func (f jsonFile) load(list interface{}) {
+	data, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = json.Unmarshal(data, list); err != nil {
+		log.Fatalf("ERR parsing %s %s: %v\n", f.kind, f.path, err)
+	}
+}
+
+// save writes list to a temporary file next to the file and renames it, so a crash never leaves a truncated file
+func (f jsonFile) save(list interface{}) {
+	if f.path == "" {
+		return
+	}
+	data, _ := json.MarshalIndent(list, "", "  ")
+	if err := writeFileAtomic(f.path, data); err != nil {
+		log.Printf("ERR writing %s %s: %v\n", f.kind, f.path, err)
+	}
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
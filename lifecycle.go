@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	statusScheduled = "scheduled"
+	statusStarted   = "started"
+	statusFinished  = "finished"
+	statusFailed    = "failed"
+	statusCancelled = "cancelled"
+
+	errorCategoryDataset     = "dataset"
+	errorCategoryMethod      = "method"
+	errorCategoryResponse    = "response"
+	errorCategoryTimeout     = "timeout"
+	errorCategoryUnavailable = "unavailable"
+	errorCategoryStorage     = "storage"
+	errorCategoryDependency  = "dependency"
+	errorCategoryRestart     = "restart"
+	errorCategoryCancelled   = "cancelled"
+)
+
+// resultTransitions lists the statuses a result may change to. Finished, failed and cancelled results
+// may only be scheduled again, which starts a new run under the same name; a cancelled result is never
+// started. Finished results may be stored again with new metrics, e.g. their evaluation. Results that
+// are not known yet may also fail, e.g. jobs of a previous process that are reconciled after a restart.
+var resultTransitions = map[string][]string{
+	"":              {statusScheduled, statusStarted, statusFailed},
+	statusScheduled: {statusScheduled, statusStarted, statusFailed, statusCancelled},
+	statusStarted:   {statusStarted, statusFinished, statusFailed, statusCancelled},
+	statusFinished:  {statusScheduled, statusFinished},
+	statusFailed:    {statusScheduled},
+	statusCancelled: {statusScheduled},
+}
+
+// ResultError model, why a result failed
+type ResultError struct {
+	Message    string `json:"message"`
+	Category   string `json:"category"`
+	HTTPStatus int    `json:"http_status,omitempty"`
+}
+
+// DownstreamError is returned if a downstream service answers with an error status
+type DownstreamError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *DownstreamError) Error() string {
+	return fmt.Sprintf("%s responded with status %d", e.URL, e.StatusCode)
+}
+
+// checkResponseStatus returns a DownstreamError if the response status is not 2xx
+func checkResponseStatus(res *http.Response, url string) error {
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return &DownstreamError{URL: url, StatusCode: res.StatusCode}
+	}
+	return nil
+}
+
+// InvalidTransitionError is returned if a result may not change from its current status to the new one
+type InvalidTransitionError struct {
+	Name string
+	From string
+	To   string
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("result %s cannot change from %s to %s", e.Name, e.From, e.To)
+}
+
+// newResultError describes err, errors of downstream calls are categorized by their cause
+func newResultError(err error, category string) *ResultError {
+	resultError := &ResultError{Message: err.Error(), Category: category}
+	var downstreamError *DownstreamError
+	var circuitError *CircuitOpenError
+	var malformedError *MalformedResponseError
+	var netError net.Error
+	switch {
+	case errors.As(err, &downstreamError):
+		resultError.HTTPStatus = downstreamError.StatusCode
+	case errors.As(err, &malformedError):
+		resultError.Category = errorCategoryResponse
+	case errors.As(err, &circuitError):
+		resultError.Category = errorCategoryUnavailable
+	case errors.As(err, &netError) && netError.Timeout():
+		resultError.Category = errorCategoryTimeout
+	case errors.As(err, &netError):
+		resultError.Category = errorCategoryUnavailable
+	}
+	return resultError
+}
+
+// fail marks the result failed with the reason
+func (r *Result) fail(err error, category string) {
+	r.Status = statusFailed
+	r.Error = newResultError(err, category)
+}
+
+type resultState struct {
+	status     string
+	result     Result
+	finishedAt time.Time
+}
+
+// ResultStates tracks the status of every result to enforce the result state machine
+type ResultStates struct {
+	mu     sync.Mutex
+	states map[string]*resultState
+}
+
+var resultStates = &ResultStates{states: make(map[string]*resultState)}
+
+// storeResult validates the status change, stores the result and publishes its status to the job event streams
+// once it is stored. The attempts, finish time and duration of the result are updated.
+func storeResult(result *Result) error {
+	if err := resultStates.transition(result); err != nil {
+		log.Printf("ERR %v\n", err)
+		return err
+	}
+	if err := RESTPostStoreResult(*result); err != nil {
+		return err
+	}
+	jobEvents.Publish(JobEvent{Type: jobEventStatus, Job: result.Name, Method: result.Method, Status: result.Status})
+	if isTerminal(result.Status) {
+		jobJournal.End(*result)
+	}
+	return nil
+}
+
+// transition validates the status change of the result and updates its attempts, finish time and duration
+func (s *ResultStates) transition(result *Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[result.Name]
+	if !ok {
+		state = &resultState{}
+		s.states[result.Name] = state
+	}
+
+	allowed := false
+	for _, status := range resultTransitions[state.status] {
+		if status == result.Status {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return &InvalidTransitionError{Name: result.Name, From: state.status, To: result.Status}
+	}
+
+	now := time.Now()
+	switch result.Status {
+	case statusScheduled:
+		result.FinishedAt = nil
+		result.DurationSeconds = 0
+		result.Error = nil
+	case statusStarted:
+		if state.status != statusStarted {
+			result.Attempts++
+		}
+		result.FinishedAt = nil
+		result.DurationSeconds = 0
+		result.Error = nil
+	default:
+		if state.status == result.Status && result.FinishedAt != nil {
+			break
+		}
+		result.FinishedAt = &now
+		if !result.StartedAt.IsZero() {
+			result.DurationSeconds = now.Sub(result.StartedAt).Seconds()
+		}
+		state.finishedAt = now
+	}
+	state.status = result.Status
+	state.result = *result
+
+	for name, other := range s.states {
+		if !other.finishedAt.IsZero() && now.Sub(other.finishedAt) > jobEventStatusRetention {
+			delete(s.states, name)
+		}
+	}
+	return nil
+}
+
+// load tracks a result read from the storage with its stored status, unless the result is known already
+func (s *ResultStates) load(result Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.states[result.Name]; !ok {
+		s.states[result.Name] = &resultState{status: result.Status, result: result}
+	}
+}
+
+// status returns the last stored status of the result, empty if it is not known
+func (s *ResultStates) status(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.states[name]; ok {
+		return state.status
+	}
+	return ""
+}
+
+// active returns the last stored version of a scheduled or started result
+func (s *ResultStates) active(name string) (Result, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[name]
+	if !ok || (state.status != statusScheduled && state.status != statusStarted) {
+		return Result{}, false
+	}
+	return state.result, true
+}
+
+// isInvalidTransition reports whether err is an InvalidTransitionError, e.g. because the result was cancelled
+func isInvalidTransition(err error) bool {
+	var transitionError *InvalidTransitionError
+	return errors.As(err, &transitionError)
+}
+
+// respondWithStoreError answers 409 if the status change was rejected, storage errors are handled by handleErrorWithResponse
+func respondWithStoreError(w http.ResponseWriter, err error) {
+	if !isInvalidTransition(err) {
+		handleErrorWithResponse(w, err, "Error saving to database")
+		return
+	}
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	w.WriteHeader(http.StatusConflict)
+	_ = json.NewEncoder(w).Encode(ResponseMessage{Status: false, Message: err.Error()})
+}
+
+// isTerminal reports whether the result is finished, failed or cancelled
+func isTerminal(status string) bool {
+	return status == statusFinished || status == statusFailed || status == statusCancelled
+}
+
+// postCancelResult cancels a scheduled or started result, its output is discarded when the method answers
+func postCancelResult(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	fmt.Printf("postCancelResult called. Result: %v\n", name)
+
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	result, ok := resultStates.active(name)
+	if !ok {
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(ResponseMessage{Status: false, Message: "Result is not scheduled or started"})
+		return
+	}
+	result.Status = statusCancelled
+	result.Error = &ResultError{Message: "cancelled by user", Category: errorCategoryCancelled}
+	err := storeResult(&result)
+	if err != nil {
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(ResponseMessage{Status: false, Message: err.Error()})
+		return
+	}
+	notifyCallback(result)
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(ResponseMessage{Status: true, Message: "Result cancelled"})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+const ownerKey = "owner"
+
+// methodQueue holds the requests waiting for a method, grouped by owner
+type methodQueue struct {
+	running int
+	owners  []string
+	waiting map[string][]chan struct{}
+	next    int
+}
+
+// MethodLimiter limits the number of concurrent requests per method. Waiting requests are
+// served round-robin across owners (users or teams), so a single owner cannot starve the others.
+type MethodLimiter struct {
+	mu     sync.Mutex
+	queues map[string]*methodQueue
+}
+
+// MethodLoad model, running and waiting requests of a method
+type MethodLoad struct {
+	Method        string         `json:"method"`
+	MaxConcurrent int            `json:"max_concurrent"`
+	Running       int            `json:"running"`
+	Waiting       map[string]int `json:"waiting"`
+}
+
+var methodLimiter = &MethodLimiter{queues: make(map[string]*methodQueue)}
+
+// Acquire blocks until the owner may send a request to the method and returns the function that frees the slot.
+// A limit <= 0 means the method has no limit.
+func (l *MethodLimiter) Acquire(method string, owner string, limit int) (release func()) {
+	if limit <= 0 {
+		return func() {}
+	}
+	l.mu.Lock()
+	queue, ok := l.queues[method]
+	if !ok {
+		queue = &methodQueue{waiting: make(map[string][]chan struct{})}
+		l.queues[method] = queue
+	}
+	if queue.running < limit && len(queue.owners) == 0 {
+		queue.running++
+		l.mu.Unlock()
+		return func() { l.release(method) }
+	}
+
+	ready := make(chan struct{})
+	if len(queue.waiting[owner]) == 0 {
+		queue.owners = append(queue.owners, owner)
+	}
+	queue.waiting[owner] = append(queue.waiting[owner], ready)
+	l.mu.Unlock()
+
+	<-ready
+	return func() { l.release(method) }
+}
+
+// release hands the slot to the next owner in turn or frees it
+func (l *MethodLimiter) release(method string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	queue := l.queues[method]
+	if len(queue.owners) == 0 {
+		queue.running--
+		return
+	}
+
+	i := queue.next % len(queue.owners)
+	owner := queue.owners[i]
+	ready := queue.waiting[owner][0]
+	queue.waiting[owner] = queue.waiting[owner][1:]
+	if len(queue.waiting[owner]) == 0 {
+		delete(queue.waiting, owner)
+		queue.owners = append(queue.owners[:i], queue.owners[i+1:]...)
+		queue.next = i
+	} else {
+		queue.next = i + 1
+	}
+	close(ready)
+}
+
+// Load returns the running and waiting requests of all limited methods
+func (l *MethodLimiter) Load() []MethodLoad {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	loads := make([]MethodLoad, 0, len(l.queues))
+	for method, queue := range l.queues {
+		load := MethodLoad{
+			Method:        method,
+			MaxConcurrent: methodRegistry.Resolve(method).MaxConcurrent,
+			Running:       queue.running,
+			Waiting:       make(map[string]int),
+		}
+		for owner, waiting := range queue.waiting {
+			load.Waiting[owner] = len(waiting)
+		}
+		loads = append(loads, load)
+	}
+	sort.Slice(loads, func(i, j int) bool { return loads[i].Method < loads[j].Method })
+	return loads
+}
+
+// callMethod sends the run to the method once the owner of the result gets a free slot
+func callMethod(result Result, run Run) (Result, error) {
+	method := methodRegistry.Resolve(run.Method)
+	release := methodLimiter.Acquire(run.Method, result.Owner, method.MaxConcurrent)
+	defer release()
+	return RESTPostStartNewDetection(result, run)
+}
+
+// getMethodLoad lists the running and waiting requests of the methods with a concurrency limit
+func getMethodLoad(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(methodLimiter.Load())
+}
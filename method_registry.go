@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultMethodRegistryFile = "methods.json"
+
+// ParamProperty describes a single method parameter (subset of JSON schema)
+type ParamProperty struct {
+	Type        string        `json:"type"`
+	Description string        `json:"description,omitempty"`
+	Default     interface{}   `json:"default,omitempty"`
+	Minimum     *float64      `json:"minimum,omitempty"`
+	Maximum     *float64      `json:"maximum,omitempty"`
+	Enum        []interface{} `json:"enum,omitempty"`
+}
+
+// ParamSchema describes the parameters a method accepts (subset of JSON schema).
+// Parameters that are not in the properties are rejected unless additionalProperties is true
+type ParamSchema struct {
+	Type                 string                   `json:"type"`
+	Properties           map[string]ParamProperty `json:"properties"`
+	Required             []string                 `json:"required,omitempty"`
+	AdditionalProperties bool                     `json:"additionalProperties,omitempty"`
+}
+
+// MethodConfig model, describes how the microservice of a method is reached
+type MethodConfig struct {
+	Name           string          `json:"name"`
+	Description    string          `json:"description,omitempty"`
+	BaseURL        string          `json:"base_url,omitempty"`
+	Path           string          `json:"path"`
+	TimeoutSeconds int             `json:"timeout_seconds,omitempty"`
+	MaxConcurrent  int             `json:"max_concurrent,omitempty"`
+	Family         string          `json:"family,omitempty"`
+	Params         ParamSchema     `json:"params"`
+	Chunking       *ChunkingConfig `json:"chunking,omitempty"`
+}
+
+// MethodRegistry holds all known methods by name and the names of the methods by the path of their run endpoint
+type MethodRegistry struct {
+	mu      sync.RWMutex
+	methods map[string]MethodConfig
+	paths   map[string]string
+}
+
+type methodRegistryFile struct {
+	Methods []MethodConfig `json:"methods"`
+}
+
+var methodRegistry = loadMethodRegistry(methodRegistryPath())
+
+func methodRegistryPath() string {
+	path := os.Getenv("METHOD_REGISTRY_FILE")
+	if path == "" {
+		pwd, _ := os.Getwd()
+		path = pwd + "/" + defaultMethodRegistryFile
+	}
+	return path
+}
+
+// loadMethodRegistry reads the registry from the given file, without the file every method uses the default
+// concept detection route and is not validated
+func loadMethodRegistry(path string) *MethodRegistry {
+	registry := &MethodRegistry{methods: make(map[string]MethodConfig), paths: make(map[string]string)}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Printf("No method registry found at %s, no methods are registered\n", path)
+		return registry
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var file methodRegistryFile
+	if err = json.Unmarshal(data, &file); err != nil {
+		log.Fatalf("ERR parsing method registry %s: %v\n", path, err)
+	}
+	for _, method := range file.Methods {
+		if method.Name == "" {
+			log.Fatalf("ERR method registry %s contains a method without name\n", path)
+		}
+		if method.Params.Type == "" {
+			method.Params.Type = "object"
+		}
+		if method.Params.Properties == nil {
+			method.Params.Properties = map[string]ParamProperty{}
+		}
+		if !isMethodFamily(method.Family) {
+			log.Fatalf("ERR method registry %s, method %s: unknown family %s\n", path, method.Name, method.Family)
+		}
+		if method.Chunking != nil {
+			if err = method.Chunking.validate(method.Family); err != nil {
+				log.Fatalf("ERR method registry %s, method %s: %v\n", path, method.Name, err)
+			}
+		}
+		registry.Register(method)
+	}
+	return registry
+}
+
+// Register adds or replaces a method
+func (r *MethodRegistry) Register(method MethodConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if previous, ok := r.methods[method.Name]; ok && r.paths[previous.Path] == method.Name {
+		delete(r.paths, previous.Path)
+	}
+	r.methods[method.Name] = method
+	r.paths[method.Path] = method.Name
+}
+
+// Unregister removes a method
+func (r *MethodRegistry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if method, ok := r.methods[name]; ok {
+		if r.paths[method.Path] == name {
+			delete(r.paths, method.Path)
+		}
+		delete(r.methods, name)
+	}
+}
+
+// Get returns the configuration of a registered method
+func (r *MethodRegistry) Get(name string) (MethodConfig, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	method, ok := r.methods[name]
+	return method, ok
+}
+
+// MethodAt returns the name of the registered method whose run endpoint has the path
+func (r *MethodRegistry) MethodAt(path string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	name, ok := r.paths[path]
+	return name, ok
+}
+
+// List returns all registered methods sorted by name
+func (r *MethodRegistry) List() []MethodConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	methods := make([]MethodConfig, 0, len(r.methods))
+	for _, method := range r.methods {
+		methods = append(methods, method)
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Name < methods[j].Name })
+	return methods
+}
+
+// Resolve returns the configuration of a method, unregistered methods use the default concept detection route
+func (r *MethodRegistry) Resolve(name string) MethodConfig {
+	if method, ok := r.Get(name); ok {
+		return method
+	}
+	return MethodConfig{
+		Name:   name,
+		Path:   endpointPostStartConceptDetection + name + "/run",
+		Params: ParamSchema{Type: "object", Properties: map[string]ParamProperty{}, AdditionalProperties: true},
+	}
+}
+
+// RunURL returns the url the run request of the method is sent to
+func (m MethodConfig) RunURL() string {
+	if m.BaseURL != "" {
+		return m.BaseURL + m.Path
+	}
+	return baseURL + m.Path
+}
+
+// Timeout returns the request timeout of the method, 0 means the default client timeout is used
+func (m MethodConfig) Timeout() time.Duration {
+	return time.Duration(m.TimeoutSeconds) * time.Second
+}
+
+// getMethods lists all registered methods and their parameters
+func getMethods(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(methodRegistry.List())
+}
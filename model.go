@@ -126,23 +126,37 @@ type Document struct {
 
 // Result model
 type Result struct {
-	Method      string                 `json:"method"`
-	Status      string                 `json:"status"`
-	StartedAt   time.Time              `json:"started_at"`
-	DatasetName string                 `json:"dataset_name"`
-	Params      map[string]string      `json:"params"`
-	Topics      map[string]interface{} `json:"topics"`
-	DocTopic    map[string]interface{} `json:"doc_topic"`
-	Metrics     map[string]interface{} `json:"metrics"`
-	Name        string                 `json:"name"`
-	Codes       []Code                 `json:"codes"`
+	Method          string                 `json:"method"`
+	Status          string                 `json:"status"`
+	StartedAt       time.Time              `json:"started_at"`
+	DatasetName     string                 `json:"dataset_name"`
+	Params          map[string]string      `json:"params"`
+	Topics          map[string]interface{} `json:"topics"`
+	DocTopic        map[string]interface{} `json:"doc_topic"`
+	Metrics         map[string]interface{} `json:"metrics"`
+	Name            string                 `json:"name"`
+	Codes           []Code                 `json:"codes"`
+	Parent          string                 `json:"parent,omitempty"`
+	Children        []string               `json:"children,omitempty"`
+	Owner           string                 `json:"owner,omitempty"`
+	FinishedAt      *time.Time             `json:"finished_at,omitempty"`
+	DurationSeconds float64                `json:"duration_seconds,omitempty"`
+	Attempts        int                    `json:"attempts,omitempty"`
+	Error           *ResultError           `json:"error,omitempty"`
+	CallbackURL     string                 `json:"-"`
 }
 
 // Run model
 type Run struct {
-	Method  string            `json:"method"`
-	Dataset Dataset           `json:"dataset"`
-	Params  map[string]string `json:"params"`
+	Method    string            `json:"method"`
+	Dataset   Dataset           `json:"dataset"`
+	Params    map[string]string `json:"params"`
+	ChunkSize int               `json:"-"`
+	Force     bool              `json:"-"`
+	Preview   bool              `json:"-"`
+	// ProtectedTerms are glossary terms the spellchecker must not correct
+	ProtectedTerms []string `json:"protected_terms,omitempty"`
+	FlagGlossary   bool     `json:"-"`
 }
 
 // ResponseMessage model
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParamError model, describes why a single parameter is invalid
+type ParamError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrorResponse model
+type ValidationErrorResponse struct {
+	Message string       `json:"message"`
+	Status  bool         `json:"status"`
+	Errors  []ParamError `json:"errors"`
+}
+
+// Validate checks the params against the schema and returns them with defaults applied.
+// Numbers and booleans may also be sent as strings, since the frontend sends form values as strings.
+func (s ParamSchema) Validate(params map[string]interface{}) (map[string]interface{}, []ParamError) {
+	validated := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		if value != nil {
+			validated[key] = value
+		}
+	}
+
+	var paramErrors []ParamError
+	for _, key := range s.Required {
+		if _, ok := validated[key]; !ok {
+			if _, hasDefault := s.defaultValue(key); !hasDefault {
+				paramErrors = append(paramErrors, ParamError{Field: key, Message: "parameter is required"})
+			}
+		}
+	}
+
+	if !s.AdditionalProperties {
+		for key := range validated {
+			if _, ok := s.Properties[key]; !ok {
+				paramErrors = append(paramErrors, ParamError{Field: key, Message: "unknown parameter"})
+			}
+		}
+	}
+
+	for key, property := range s.Properties {
+		value, ok := validated[key]
+		if !ok {
+			if property.Default != nil {
+				validated[key] = property.Default
+			}
+			continue
+		}
+		if message := property.check(value); message != "" {
+			paramErrors = append(paramErrors, ParamError{Field: key, Message: message})
+		}
+	}
+
+	sort.Slice(paramErrors, func(i, j int) bool { return paramErrors[i].Field < paramErrors[j].Field })
+	return validated, paramErrors
+}
+
+func (s ParamSchema) defaultValue(key string) (interface{}, bool) {
+	property, ok := s.Properties[key]
+	if !ok || property.Default == nil {
+		return nil, false
+	}
+	return property.Default, true
+}
+
+// check returns an error message if the value does not match the property, otherwise ""
+func (p ParamProperty) check(value interface{}) string {
+	switch p.Type {
+	case "integer", "number":
+		number, ok := toNumber(value)
+		if !ok {
+			return fmt.Sprintf("must be of type %s", p.Type)
+		}
+		if p.Type == "integer" && number != math.Trunc(number) {
+			return "must be of type integer"
+		}
+		if p.Minimum != nil && number < *p.Minimum {
+			return fmt.Sprintf("must be >= %v", *p.Minimum)
+		}
+		if p.Maximum != nil && number > *p.Maximum {
+			return fmt.Sprintf("must be <= %v", *p.Maximum)
+		}
+	case "boolean":
+		switch v := value.(type) {
+		case bool:
+		case string:
+			if _, err := strconv.ParseBool(v); err != nil {
+				return "must be of type boolean"
+			}
+		default:
+			return "must be of type boolean"
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return "must be of type string"
+		}
+	case "array":
+		if _, ok := value.([]interface{}); !ok {
+			return "must be of type array"
+		}
+	case "object":
+		if _, ok := value.(map[string]interface{}); !ok {
+			return "must be of type object"
+		}
+	}
+
+	if len(p.Enum) > 0 {
+		for _, allowed := range p.Enum {
+			if fmt.Sprintf("%v", allowed) == fmt.Sprintf("%v", value) {
+				return ""
+			}
+		}
+		var allowedValues []string
+		for _, allowed := range p.Enum {
+			allowedValues = append(allowedValues, fmt.Sprintf("%v", allowed))
+		}
+		return "must be one of " + strings.Join(allowedValues, ", ")
+	}
+	return ""
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return number, err == nil
+	}
+	return 0, false
+}
+
+// stringifyParams converts the params to the string map that is sent to the method microservices
+func stringifyParams(params map[string]interface{}) map[string]string {
+	var stringParams = make(map[string]string)
+	for key, value := range params {
+		stringParams[key] = fmt.Sprintf("%v", value)
+	}
+	return stringParams
+}
+
+func respondWithParamErrors(w http.ResponseWriter, paramErrors []ParamError) {
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(ValidationErrorResponse{Status: false, Message: "Invalid parameters", Errors: paramErrors})
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	stepKindSpellcheck = "spellcheck"
+	stepKindRelevance  = "relevance"
+	stepKindDetection  = "detection"
+
+	pipelineMethod = "pipeline"
+)
+
+var pipelineTemplatePattern = regexp.MustCompile(`{{\s*([a-zA-Z0-9_.\-]+)\s*}}`)
+
+// PipelineStep model, a single analysis of a pipeline
+type PipelineStep struct {
+	ID        string                 `json:"id"`
+	Kind      string                 `json:"kind"`
+	Method    string                 `json:"method"`
+	Name      string                 `json:"name"`
+	Dataset   string                 `json:"dataset"`
+	DependsOn []string               `json:"depends_on"`
+	Params    map[string]interface{} `json:"params"`
+}
+
+// Pipeline model, steps are executed once all steps they depend on are finished.
+// Dataset, name and string params of a step may reference {{dataset}}, {{name}}, {{params.<key>}}
+// and {{steps.<id>.dataset}} or {{steps.<id>.name}} of the steps it depends on.
+type Pipeline struct {
+	Name        string                 `json:"name"`
+	Dataset     string                 `json:"dataset"`
+	Params      map[string]interface{} `json:"params"`
+	Steps       []PipelineStep         `json:"steps"`
+	CallbackURL string                 `json:"callback_url"`
+	Owner       string                 `json:"owner"`
+}
+
+// resolvedStep is a pipeline step with all templates replaced
+type resolvedStep struct {
+	PipelineStep
+	Params        map[string]string
+	OutputDataset string
+}
+
+// postStartPipeline validates a pipeline and runs it in the background
+func postStartPipeline(w http.ResponseWriter, r *http.Request) {
+	var pipeline Pipeline
+	err := json.NewDecoder(r.Body).Decode(&pipeline)
+	if err != nil {
+		fmt.Printf("ERROR decoding body: %s, body: %v\n", err, r.Body)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	fmt.Printf("postStartPipeline called. Name: %v, Dataset: %v\n", pipeline.Name, pipeline.Dataset)
+
+	steps, paramErrors := resolvePipeline(pipeline)
+	if len(paramErrors) > 0 {
+		respondWithParamErrors(w, paramErrors)
+		return
+	}
+	fmt.Printf("postStartPipeline execution order: %s\n", pipelineStepIDs(steps))
+
+	parent := new(Result)
+	parent.Method = pipelineMethod
+	parent.DatasetName = pipeline.Dataset
+	parent.Status = statusScheduled
+	parent.StartedAt = time.Now()
+	parent.Params = stringifyParams(pipeline.Params)
+	parent.Name = pipeline.Name
+	parent.CallbackURL = pipeline.CallbackURL
+	parent.Owner = pipeline.Owner
+	for _, step := range steps {
+		parent.Children = append(parent.Children, step.Name)
+	}
+
+	if err = storeResult(parent); err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	go _runPipeline(parent, steps)
+
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(ResponseMessage{Status: true, Message: "Pipeline started"})
+}
+
+// resolvePipeline validates the pipeline, replaces all templates and returns the steps in execution order
+func resolvePipeline(pipeline Pipeline) ([]resolvedStep, []ParamError) {
+	var paramErrors []ParamError
+	if pipeline.Name == "" {
+		paramErrors = append(paramErrors, ParamError{Field: "name", Message: "parameter is required"})
+	}
+	if len(pipeline.Steps) == 0 {
+		paramErrors = append(paramErrors, ParamError{Field: "steps", Message: "pipeline has no steps"})
+	}
+	if callbackErr := validateCallbackURL(pipeline.CallbackURL); callbackErr != nil {
+		paramErrors = append(paramErrors, *callbackErr)
+	}
+
+	stepsByID := make(map[string]PipelineStep)
+	for i, step := range pipeline.Steps {
+		field := fmt.Sprintf("steps[%d]", i)
+		if step.ID == "" {
+			paramErrors = append(paramErrors, ParamError{Field: field + ".id", Message: "parameter is required"})
+		} else if _, duplicate := stepsByID[step.ID]; duplicate {
+			paramErrors = append(paramErrors, ParamError{Field: field + ".id", Message: "step id is not unique"})
+		}
+		switch step.Kind {
+		case stepKindSpellcheck, stepKindRelevance, stepKindDetection:
+		default:
+			paramErrors = append(paramErrors, ParamError{Field: field + ".kind", Message: "must be one of spellcheck, relevance, detection"})
+		}
+		if step.Method == "" {
+			paramErrors = append(paramErrors, ParamError{Field: field + ".method", Message: "parameter is required"})
+		}
+		stepsByID[step.ID] = step
+	}
+	for i, step := range pipeline.Steps {
+		for _, dependency := range step.DependsOn {
+			if _, ok := stepsByID[dependency]; !ok {
+				paramErrors = append(paramErrors, ParamError{Field: fmt.Sprintf("steps[%d].depends_on", i), Message: "unknown step " + dependency})
+			}
+		}
+	}
+	if len(paramErrors) > 0 {
+		return nil, paramErrors
+	}
+
+	order, err := topologicalOrder(pipeline.Steps)
+	if err != nil {
+		return nil, []ParamError{{Field: "steps", Message: err.Error()}}
+	}
+
+	pipelineVars := map[string]string{"dataset": pipeline.Dataset, "name": pipeline.Name}
+	for key, value := range pipeline.Params {
+		pipelineVars["params."+key] = fmt.Sprintf("%v", value)
+	}
+
+	var steps []resolvedStep
+	resolvedByID := make(map[string]resolvedStep)
+	for _, step := range order {
+		field := "steps." + step.ID
+		resolved := resolvedStep{PipelineStep: step}
+
+		// a step may only reference the outputs of steps it depends on
+		vars := make(map[string]string)
+		for key, value := range pipelineVars {
+			vars[key] = value
+		}
+		for _, dependency := range step.DependsOn {
+			vars["steps."+dependency+".dataset"] = resolvedByID[dependency].OutputDataset
+			vars["steps."+dependency+".name"] = resolvedByID[dependency].Name
+		}
+
+		var templateErrors []string
+		resolved.Dataset = expandPipelineTemplate(step.Dataset, vars, &templateErrors)
+		if step.Dataset == "" {
+			resolved.Dataset = pipeline.Dataset
+		}
+		resolved.Name = expandPipelineTemplate(step.Name, vars, &templateErrors)
+		if step.Name == "" {
+			resolved.Name = pipeline.Name + "/" + step.ID
+		}
+
+		rawParams := make(map[string]interface{})
+		for key, value := range step.Params {
+			if s, ok := value.(string); ok {
+				value = expandPipelineTemplate(s, vars, &templateErrors)
+			}
+			rawParams[key] = value
+		}
+		for _, message := range templateErrors {
+			paramErrors = append(paramErrors, ParamError{Field: field, Message: message})
+		}
+		if resolved.Dataset == "" {
+			paramErrors = append(paramErrors, ParamError{Field: field + ".dataset", Message: "parameter is required"})
+		}
+
+		// steps are validated like the requests of their kind
+		params, stepErrors := analysisKinds[step.Kind].validateParams(step.Method, rawParams)
+		for _, stepError := range stepErrors {
+			paramErrors = append(paramErrors, ParamError{Field: field + ".params." + stepError.Field, Message: stepError.Message})
+		}
+		resolved.Params = params
+
+		// spellchecking and relevance classification store a new dataset, later steps work on it
+		resolved.OutputDataset = resolved.Dataset
+		if newDatasetName, ok := resolved.Params["new_dataset_name"]; ok && step.Kind != stepKindDetection && newDatasetName != "" {
+			resolved.OutputDataset = newDatasetName
+		}
+		resolvedByID[step.ID] = resolved
+		steps = append(steps, resolved)
+	}
+	return steps, paramErrors
+}
+
+// expandPipelineTemplate replaces all {{var}} in s, unknown vars are reported in templateErrors
+func expandPipelineTemplate(s string, vars map[string]string, templateErrors *[]string) string {
+	return pipelineTemplatePattern.ReplaceAllStringFunc(s, func(match string) string {
+		key := pipelineTemplatePattern.FindStringSubmatch(match)[1]
+		value, ok := vars[key]
+		if !ok {
+			*templateErrors = append(*templateErrors, "unknown template variable "+key)
+			return match
+		}
+		return value
+	})
+}
+
+// topologicalOrder orders the steps so that every step comes after the steps it depends on
+func topologicalOrder(steps []PipelineStep) ([]PipelineStep, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	stepsByID := make(map[string]PipelineStep)
+	for _, step := range steps {
+		stepsByID[step.ID] = step
+	}
+	state := make(map[string]int)
+	var order []PipelineStep
+	var visit func(step PipelineStep) error
+	visit = func(step PipelineStep) error {
+		switch state[step.ID] {
+		case visiting:
+			return fmt.Errorf("steps contain a cycle at step %s", step.ID)
+		case visited:
+			return nil
+		}
+		state[step.ID] = visiting
+		for _, dependency := range step.DependsOn {
+			if err := visit(stepsByID[dependency]); err != nil {
+				return err
+			}
+		}
+		state[step.ID] = visited
+		order = append(order, step)
+		return nil
+	}
+	for _, step := range steps {
+		if err := visit(step); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+func _runPipeline(parent *Result, steps []resolvedStep) {
+	parent.Status = statusStarted
+	jobJournal.StartParent(*parent)
+	_ = storeResult(parent)
+
+	var mu sync.Mutex
+	statuses := make(map[string]string)
+	done := make(map[string]chan struct{})
+	for _, step := range steps {
+		done[step.ID] = make(chan struct{})
+	}
+
+	var wg sync.WaitGroup
+	for _, step := range steps {
+		wg.Add(1)
+		go func(step resolvedStep) {
+			defer wg.Done()
+			defer close(done[step.ID])
+
+			// wait for all dependencies, skip the step if one of them did not finish
+			for _, dependency := range step.DependsOn {
+				<-done[dependency]
+				mu.Lock()
+				dependencyStatus := statuses[dependency]
+				mu.Unlock()
+				if dependencyStatus != statusFinished {
+					logJob(*parent, "skipping step %s, step %s is %s", step.ID, dependency, dependencyStatus)
+					skipPipelineStep(parent, step, fmt.Sprintf("step %s is %s", dependency, dependencyStatus))
+					mu.Lock()
+					statuses[step.ID] = "skipped"
+					mu.Unlock()
+					return
+				}
+			}
+
+			status := _runPipelineStep(parent, step)
+			mu.Lock()
+			statuses[step.ID] = status
+			mu.Unlock()
+		}(step)
+	}
+	wg.Wait()
+
+	parent.Status = statusFinished
+	stepStatuses := make(map[string]interface{})
+	var failedSteps []string
+	for id, status := range statuses {
+		stepStatuses[id] = status
+		if status != statusFinished {
+			failedSteps = append(failedSteps, id)
+		}
+	}
+	if len(failedSteps) > 0 {
+		sort.Strings(failedSteps)
+		parent.fail(fmt.Errorf("steps not finished: %s", strings.Join(failedSteps, ", ")), errorCategoryDependency)
+	}
+	parent.Metrics = map[string]interface{}{"steps": stepStatuses}
+	if err := storeResult(parent); !isInvalidTransition(err) {
+		notifyCallback(*parent)
+	}
+}
+
+// newPipelineChild stores the scheduled child result of a step
+func newPipelineChild(parent *Result, step resolvedStep) *Result {
+	child := new(Result)
+	child.Method = step.Method
+	child.DatasetName = step.Dataset
+	child.Status = statusScheduled
+	child.StartedAt = time.Now()
+	child.Params = step.Params
+	child.Name = step.Name
+	child.Parent = parent.Name
+	child.Owner = parent.Owner
+	_ = storeResult(child)
+	return child
+}
+
+// skipPipelineStep stores the child result of a step that is not run because a dependency did not finish as cancelled
+func skipPipelineStep(parent *Result, step resolvedStep, reason string) {
+	child := newPipelineChild(parent, step)
+	child.Status = statusCancelled
+	child.Error = &ResultError{Message: "skipped, " + reason, Category: errorCategoryDependency}
+	_ = storeResult(child)
+}
+
+// _runPipelineStep runs a single step and stores it as child result of the pipeline, returns the final status
+func _runPipelineStep(parent *Result, step resolvedStep) string {
+	child := newPipelineChild(parent, step)
+	child.Status = statusStarted
+	if err := storeResult(child); isInvalidTransition(err) {
+		logJob(*parent, "step %s not started: %s", step.ID, err)
+		return resultStates.status(child.Name)
+	}
+	logJob(*parent, "step %s (%s %s) started on dataset %s", step.ID, step.Kind, step.Method, step.Dataset)
+
+	category := errorCategoryMethod
+	dataset, err := RESTGetDataset(step.Dataset)
+	if err != nil {
+		category = errorCategoryDataset
+	} else {
+		run := Run{Method: step.Method, Params: step.Params, Dataset: dataset}
+		switch step.Kind {
+		case stepKindSpellcheck:
+			_, err = RESTPostStartSpellchecking(run)
+		case stepKindRelevance:
+			_, err = RESTPostStartRelevanceClassification(run)
+		case stepKindDetection:
+			*child, err = runCachedDetection(*child, run)
+		}
+	}
+	if err != nil {
+		logJob(*parent, "ERROR step %s failed: %s", step.ID, err)
+		child.fail(err, category)
+		_ = storeResult(child)
+		return child.Status
+	}
+
+	child.Status = statusFinished
+	if err = storeResult(child); err != nil {
+		logJob(*parent, "ERROR storing result of step %s: %s", step.ID, err)
+		return statusFailed
+	}
+	logJob(*parent, "step %s finished", step.ID)
+	return child.Status
+}
+
+// pipelineStepIDs returns the ids of the steps, used for log output
+func pipelineStepIDs(steps []resolvedStep) string {
+	var ids []string
+	for _, step := range steps {
+		ids = append(ids, step.ID)
+	}
+	return strings.Join(ids, ", ")
+}
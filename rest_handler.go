@@ -5,9 +5,11 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"time"
 
@@ -19,16 +21,17 @@ var bearerToken = "Bearer " + os.Getenv("BEARER_TOKEN")
 
 const (
 	// analytics layer
-	endpointPostStartConceptDetection             = "/hitec/classify/concepts/"
-	endpointPostStartAcceptanceCriteriaGeneration = "/hitec/generate/"
-	endpointPostStartRelevanceClassification      = "/hitec/classify/relevance/run"
-	endpointPostStartSpellchecking                = "/hitec/spellchecker/run"
+	endpointPostStartConceptDetection        = "/hitec/classify/concepts/"
+	endpointPostStartRelevanceClassification = "/hitec/classify/relevance/run"
+	endpointPostStartSpellchecking           = "/hitec/spellchecker/run"
 
 	// storage layer
 	endpointPostStoreDataset         = "/hitec/repository/concepts/store/dataset/"
 	endpointPostStoreGroundTruth     = "/hitec/repository/concepts/store/groundtruth/"
 	endpointPostStoreDetectionResult = "/hitec/repository/concepts/store/detection/result/"
 	endpointGetDataset               = "/hitec/repository/concepts/dataset/name/"
+	endpointGetAllDatasets           = "/hitec/repository/concepts/dataset/all"
+	endpointGetResult                = "/hitec/repository/concepts/detection/result/name/"
 
 	// annotation
 	endpointPostStoreAnnotation    = "/hitec/repository/concepts/store/annotation/"
@@ -63,11 +66,14 @@ func getHTTPClient() *http.Client {
 	timeout := 15 * time.Minute
 
 	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				RootCAs: caCertPool,
-				// InsecureSkipVerify: true,
+		Transport: &circuitBreakerTransport{
+			next: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					RootCAs: caCertPool,
+					// InsecureSkipVerify: true,
+				},
 			},
+			breakers: circuitBreakers,
 		},
 		Timeout: timeout,
 		CheckRedirect: func(req *http.Request, _ []*http.Request) error {
@@ -172,6 +178,13 @@ func RESTGetDataset(datasetName string) (Dataset, error) {
 		log.Printf("ERR get dataset %v\n", err)
 		return dataset, err
 	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(res.Body)
+	if err = checkResponseStatus(res, url); err != nil {
+		log.Printf("ERR get dataset %s %v\n", datasetName, err)
+		return dataset, err
+	}
 	// parse result
 	err = json.NewDecoder(res.Body).Decode(&dataset)
 
@@ -182,12 +195,68 @@ func RESTGetDataset(datasetName string) (Dataset, error) {
 	return dataset, err
 }
 
-func RESTPostStartRelevanceClassification(run Run) (map[string]interface{}, error) {
+// RESTGetAllDatasets returns all datasets, err
+func RESTGetAllDatasets() ([]Dataset, error) {
 	requestBody := new(bytes.Buffer)
+	var datasets []Dataset
 
-	_ = json.NewEncoder(requestBody).Encode(run)
+	// make request
+	url := baseURL + endpointGetAllDatasets
+	req, _ := createRequest(GET, url, requestBody)
+	res, err := client.Do(req)
+	if err != nil {
+		log.Printf("ERR get all datasets %v\n", err)
+		return datasets, err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(res.Body)
+	if res.StatusCode != http.StatusOK {
+		err = fmt.Errorf("storage responded with status %d", res.StatusCode)
+		log.Printf("ERR get all datasets %v\n", err)
+		return datasets, err
+	}
+	// parse result
+	err = json.NewDecoder(res.Body).Decode(&datasets)
+	if err != nil {
+		log.Printf("ERR parsing datasets %v\n", err)
+		return datasets, err
+	}
+	return datasets, err
+}
+
+// RESTGetResult returns result, err
+func RESTGetResult(resultName string) (Result, error) {
+	requestBody := new(bytes.Buffer)
+	var result Result
+
+	// make request, the names of child results contain slashes
+	resultURL := baseURL + endpointGetResult + url.PathEscape(resultName)
+	req, _ := createRequest(GET, resultURL, requestBody)
+	res, err := client.Do(req)
+	if err != nil {
+		log.Printf("ERR get result %v\n", err)
+		return result, err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(res.Body)
+	if err = checkResponseStatus(res, resultURL); err != nil {
+		log.Printf("ERR get result %v\n", err)
+		return result, err
+	}
 
-	url := baseURL + endpointPostStartRelevanceClassification
+	// parse result
+	err = json.NewDecoder(res.Body).Decode(&result)
+	if err != nil {
+		log.Printf("ERR parsing result %v\n", err)
+		return result, err
+	}
+	return result, err
+}
+
+func RESTPostStartRelevanceClassification(run Run) (map[string]interface{}, error) {
+	url, requestBody := relevanceClassificationRequest(run)
 
 	log.Printf("PostStartRelevanceClassification url: %s\n", url)
 
@@ -200,6 +269,10 @@ func RESTPostStartRelevanceClassification(run Run) (map[string]interface{}, erro
 	}
 
 	defer res.Body.Close()
+	if err = checkResponseStatus(res, url); err != nil {
+		log.Printf("ERR %v\n", err)
+		return nil, err
+	}
 
 	var message map[string]interface{}
 	err = json.NewDecoder(res.Body).Decode(&message)
@@ -212,14 +285,10 @@ func RESTPostStartRelevanceClassification(run Run) (map[string]interface{}, erro
 }
 
 func RESTPostStartSpellchecking(run Run) (map[string]interface{}, error) {
-	requestBody := new(bytes.Buffer)
-
-	_ = json.NewEncoder(requestBody).Encode(run)
+	url, requestBody := spellcheckingRequest(run)
 
 	log.Printf("RESTPostStartSpellchecking requestBody: %s\n", requestBody)
 
-	url := baseURL + endpointPostStartSpellchecking
-
 	log.Printf("RESTPostStartSpellchecking url: %s\n", url)
 
 	req, _ := createRequest(POST, url, requestBody)
@@ -231,6 +300,10 @@ func RESTPostStartSpellchecking(run Run) (map[string]interface{}, error) {
 	}
 
 	defer res.Body.Close()
+	if err = checkResponseStatus(res, url); err != nil {
+		log.Printf("ERR %v\n", err)
+		return nil, err
+	}
 
 	var message map[string]interface{}
 	err = json.NewDecoder(res.Body).Decode(&message)
@@ -242,35 +315,71 @@ func RESTPostStartSpellchecking(run Run) (map[string]interface{}, error) {
 	return message, nil
 }
 
-// RESTPostStartNewDetection returns Result ,err
-func RESTPostStartNewDetection(result Result, run Run) (Result, error) {
+// detectionRequest returns the url and body of the request that starts the detection of the run
+func detectionRequest(run Run) (string, *bytes.Buffer) {
 	requestBody := new(bytes.Buffer)
+	_ = json.NewEncoder(requestBody).Encode(run)
+	return methodRegistry.Resolve(run.Method).RunURL(), requestBody
+}
 
+// relevanceClassificationRequest returns the url and body of the request that starts the relevance classification
+func relevanceClassificationRequest(run Run) (string, *bytes.Buffer) {
+	requestBody := new(bytes.Buffer)
 	_ = json.NewEncoder(requestBody).Encode(run)
+	return baseURL + endpointPostStartRelevanceClassification, requestBody
+}
 
-	url := baseURL + endpointPostStartConceptDetection + run.Method + "/run"
-	if run.Method == "acceptance-criteria" {
-		url = baseURL + endpointPostStartAcceptanceCriteriaGeneration + run.Method + "/run"
-	}
+// spellcheckingRequest returns the url and body of the request that starts the spellchecking
+func spellcheckingRequest(run Run) (string, *bytes.Buffer) {
+	requestBody := new(bytes.Buffer)
+	_ = json.NewEncoder(requestBody).Encode(run)
+	return baseURL + endpointPostStartSpellchecking, requestBody
+}
+
+// RESTPostStartNewDetection returns Result ,err
+func RESTPostStartNewDetection(result Result, run Run) (Result, error) {
+	method := methodRegistry.Resolve(run.Method)
+	url, requestBody := detectionRequest(run)
 	log.Printf("PostStartNewDetection url: %s\n", url)
 	log.Printf(requestBody.String())
 	log.Printf("request Body")
 	req, _ := createRequest(POST, url, requestBody)
-	res, err := client.Do(req)
+	methodClient := client
+	if method.Timeout() > 0 {
+		methodClient = &http.Client{
+			Transport:     client.Transport,
+			Timeout:       method.Timeout(),
+			CheckRedirect: client.CheckRedirect,
+		}
+	}
+	res, err := methodClient.Do(req)
 	if err != nil {
 		log.Printf("ERR post start new detection %v\n", err)
 		log.Printf("Note: If the request timed out, the method microservice may take too long to process the" +
-			" request. Consider increasing timeout in rest_handler->getHTTPClient.")
+			" request. Consider increasing timeout_seconds of the method in the method registry.")
 
 		return result, err
 	}
 	defer func(Body io.ReadCloser) {
 		_ = Body.Close()
 	}(res.Body)
+	if err = checkResponseStatus(res, url); err != nil {
+		log.Printf("ERR post start new detection %v\n", err)
+		return result, err
+	}
 
-	_res := new(Result)
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		log.Printf("ERR reading response %v\n", err)
+		return result, err
+	}
+	if err = validateMethodResponse(method, data); err != nil {
+		log.Printf("ERR %v\n", err)
+		return result, err
+	}
 
-	err = json.NewDecoder(res.Body).Decode(&_res)
+	_res := new(Result)
+	err = json.Unmarshal(data, &_res)
 	if err != nil {
 		log.Printf("ERR parsing response %v\n", err)
 		return result, err
@@ -300,7 +409,7 @@ func RESTPostStoreResult(result Result) error {
 		_ = Body.Close()
 	}(res.Body)
 
-	return nil
+	return checkResponseStatus(res, url)
 }
 
 // RESTGetInfoFromAnnotations returns info from annotation,
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"sync"
+)
+
+const (
+	forceKey            = "force"
+	cachedFromMetricKey = "cached_from"
+	resultCacheSize     = 200
+)
+
+type cachedResult struct {
+	hash   string
+	result Result
+}
+
+// ResultCache holds the method output of finished detections by the hash of their run.
+// The oldest entry is evicted once resultCacheSize entries are cached.
+type ResultCache struct {
+	mu      sync.Mutex
+	entries map[string]Result
+	order   []string
+}
+
+var resultCache = &ResultCache{entries: make(map[string]Result)}
+
+// runHash returns the hash of the method, params, chunk size and document contents of the run.
+// The dataset name is not part of the hash, so identical documents uploaded under another name hit the cache.
+func runHash(run Run) string {
+	payload, _ := json.Marshal(struct {
+		Method    string            `json:"method"`
+		Params    map[string]string `json:"params"`
+		ChunkSize int               `json:"chunk_size"`
+		Documents []Document        `json:"documents"`
+	}{run.Method, run.Params, run.ChunkSize, run.Dataset.Documents})
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// Lookup returns the cached method output of a run with the given hash
+func (c *ResultCache) Lookup(hash string) (Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result, ok := c.entries[hash]
+	return result, ok
+}
+
+// Add caches the method output of a finished run
+func (c *ResultCache) Add(hash string, result Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.entries[hash]; !exists {
+		c.order = append(c.order, hash)
+	}
+	c.entries[hash] = copyMethodOutput(result, result)
+	for len(c.order) > resultCacheSize {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// cloneCachedResult copies the method output of a cached result into the new result
+func cloneCachedResult(result Result, cached Result) Result {
+	result = copyMethodOutput(result, cached)
+	if result.Metrics == nil {
+		result.Metrics = make(map[string]interface{})
+	}
+	result.Metrics[cachedFromMetricKey] = cached.Name
+	return result
+}
+
+// copyMethodOutput deep-copies the topics, doc topics, metrics and codes of from into result,
+// so that neither result shares a map, slice or pointer with the cache
+func copyMethodOutput(result Result, from Result) Result {
+	result.Topics, _ = deepCopyValue(from.Topics).(map[string]interface{})
+	result.DocTopic, _ = deepCopyValue(from.DocTopic).(map[string]interface{})
+	result.Metrics, _ = deepCopyValue(from.Metrics).(map[string]interface{})
+	result.Codes = nil
+	if from.Codes != nil {
+		result.Codes = make([]Code, len(from.Codes))
+	}
+	for i, code := range from.Codes {
+		code.Index = copyIntPointer(code.Index)
+		code.Tokens = copyIntPointers(code.Tokens)
+		code.RelationshipMemberships = copyIntPointers(code.RelationshipMemberships)
+		result.Codes[i] = code
+	}
+	return result
+}
+
+// deepCopyValue copies the maps and slices of a decoded json value, other values are immutable or copied by value
+func deepCopyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if v == nil {
+			return v
+		}
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = deepCopyValue(item)
+		}
+		return copied
+	case []interface{}:
+		if v == nil {
+			return v
+		}
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = deepCopyValue(item)
+		}
+		return copied
+	case []string:
+		return append([]string(nil), v...)
+	case []float64:
+		return append([]float64(nil), v...)
+	}
+	return value
+}
+
+func copyIntPointer(value *int) *int {
+	if value == nil {
+		return nil
+	}
+	copied := *value
+	return &copied
+}
+
+func copyIntPointers(values []*int) []*int {
+	if values == nil {
+		return nil
+	}
+	copied := make([]*int, len(values))
+	for i, value := range values {
+		copied[i] = copyIntPointer(value)
+	}
+	return copied
+}
+
+// parseForce reads the optional force flag of a request body, true bypasses the result cache
+func parseForce(body map[string]interface{}) (bool, *ParamError) {
+	return parseBoolParam(body, forceKey)
+}
+
+// parseBoolParam reads an optional boolean or boolean string from a request body
+func parseBoolParam(body map[string]interface{}, key string) (bool, *ParamError) {
+	switch value := body[key].(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return value, nil
+	case string:
+		parsed, err := strconv.ParseBool(value)
+		if err == nil {
+			return parsed, nil
+		}
+	}
+	return false, &ParamError{Field: key, Message: "must be of type boolean"}
+}
+
+// runCachedDetection reuses the output of an identical finished run unless the run is forced
+func runCachedDetection(result Result, run Run) (Result, error) {
+	hash := runHash(run)
+	if !run.Force {
+		if cached, ok := resultCache.Lookup(hash); ok {
+			logJob(result, "reusing the output of the identical run %s", cached.Name)
+			return cloneCachedResult(result, cached), nil
+		}
+	}
+	endResult, err := runDetection(result, run)
+	if err == nil {
+		resultCache.Add(hash, endResult)
+	}
+	return endResult, err
+}
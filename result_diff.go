@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// TopicOverlap model, the most similar topic of the other result for a topic (Jaccard similarity of the lemma-normalized words)
+type TopicOverlap struct {
+	Topic      string  `json:"topic"`
+	OtherTopic string  `json:"other_topic"`
+	Similarity float64 `json:"similarity"`
+}
+
+// MetricDelta model, a numeric metric of both results and its change from the base to the other result
+type MetricDelta struct {
+	Base  float64 `json:"base"`
+	Other float64 `json:"other"`
+	Delta float64 `json:"delta"`
+}
+
+// ParamChange model, a param that differs between the results, "" if a result does not have it
+type ParamChange struct {
+	Base  string `json:"base"`
+	Other string `json:"other"`
+}
+
+// ResultDiff model, the changes from the base to the other result. Concepts are aligned by their lemma-normalized form
+type ResultDiff struct {
+	Base                string                 `json:"base"`
+	Other               string                 `json:"other"`
+	AddedConcepts       []string               `json:"added_concepts"`
+	RemovedConcepts     []string               `json:"removed_concepts"`
+	SharedConcepts      []string               `json:"shared_concepts"`
+	ConceptSimilarity   float64                `json:"concept_similarity"`
+	Topics              []TopicOverlap         `json:"topics"`
+	MeanTopicSimilarity float64                `json:"mean_topic_similarity"`
+	Metrics             map[string]MetricDelta `json:"metrics"`
+	OnlyBaseMetrics     []string               `json:"only_base_metrics,omitempty"`
+	OnlyOtherMetrics    []string               `json:"only_other_metrics,omitempty"`
+	ParamChanges        map[string]ParamChange `json:"param_changes"`
+	BaseDataset         string                 `json:"base_dataset"`
+	OtherDataset        string                 `json:"other_dataset"`
+}
+
+// getResultDiff compares the stored results `base` and `other`
+func getResultDiff(w http.ResponseWriter, r *http.Request) {
+	baseName := r.URL.Query().Get("base")
+	otherName := r.URL.Query().Get("other")
+	fmt.Printf("getResultDiff called. Base: %v, Other: %v\n", baseName, otherName)
+
+	var paramErrors []ParamError
+	if baseName == "" {
+		paramErrors = append(paramErrors, ParamError{Field: "base", Message: "parameter is required"})
+	}
+	if otherName == "" {
+		paramErrors = append(paramErrors, ParamError{Field: "other", Message: "parameter is required"})
+	}
+	if len(paramErrors) > 0 {
+		respondWithParamErrors(w, paramErrors)
+		return
+	}
+
+	var results []Result
+	for _, name := range []string{baseName, otherName} {
+		result, err := RESTGetResult(name)
+		if err != nil {
+			fmt.Printf("ERROR retrieving result %s: %s\n", name, err)
+			status := http.StatusBadGateway
+			var downstreamError *DownstreamError
+			if errors.As(err, &downstreamError) && downstreamError.StatusCode == http.StatusNotFound {
+				status = http.StatusNotFound
+			}
+			w.Header().Set(contentTypeKey, contentTypeValJSON)
+			w.WriteHeader(status)
+			_ = json.NewEncoder(w).Encode(ResponseMessage{Status: false, Message: fmt.Sprintf("ERROR retrieving result %s", name)})
+			return
+		}
+		results = append(results, result)
+	}
+
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(diffResults(results[0], results[1]))
+}
+
+// diffResults returns the added, removed and shared concepts, the topic overlap and the metric deltas of two results
+func diffResults(base Result, other Result) ResultDiff {
+	diff := ResultDiff{
+		Base:            base.Name,
+		Other:           other.Name,
+		AddedConcepts:   []string{},
+		RemovedConcepts: []string{},
+		SharedConcepts:  []string{},
+		Topics:          []TopicOverlap{},
+		Metrics:         make(map[string]MetricDelta),
+		ParamChanges:    make(map[string]ParamChange),
+		BaseDataset:     base.DatasetName,
+		OtherDataset:    other.DatasetName,
+	}
+
+	baseConcepts := conceptsByKey(base)
+	otherConcepts := conceptsByKey(other)
+	for key, concept := range baseConcepts {
+		if _, ok := otherConcepts[key]; ok {
+			diff.SharedConcepts = append(diff.SharedConcepts, concept)
+		} else {
+			diff.RemovedConcepts = append(diff.RemovedConcepts, concept)
+		}
+	}
+	for key, concept := range otherConcepts {
+		if _, ok := baseConcepts[key]; !ok {
+			diff.AddedConcepts = append(diff.AddedConcepts, concept)
+		}
+	}
+	sort.Strings(diff.SharedConcepts)
+	sort.Strings(diff.RemovedConcepts)
+	sort.Strings(diff.AddedConcepts)
+	if union := len(diff.SharedConcepts) + len(diff.RemovedConcepts) + len(diff.AddedConcepts); union > 0 {
+		diff.ConceptSimilarity = float64(len(diff.SharedConcepts)) / float64(union)
+	}
+
+	baseTopics := topicWords(base)
+	otherTopics := topicWords(other)
+	for _, topic := range sortedKeys(baseTopics) {
+		overlap := TopicOverlap{Topic: topic}
+		for _, otherTopic := range sortedKeys(otherTopics) {
+			similarity := jaccard(baseTopics[topic], otherTopics[otherTopic])
+			if similarity > overlap.Similarity {
+				overlap.OtherTopic = otherTopic
+				overlap.Similarity = similarity
+			}
+		}
+		diff.Topics = append(diff.Topics, overlap)
+		diff.MeanTopicSimilarity += overlap.Similarity
+	}
+	if len(diff.Topics) > 0 {
+		diff.MeanTopicSimilarity /= float64(len(diff.Topics))
+	}
+
+	for metric, value := range base.Metrics {
+		baseValue, ok := value.(float64)
+		if !ok {
+			continue
+		}
+		otherValue, ok := other.Metrics[metric].(float64)
+		if !ok {
+			diff.OnlyBaseMetrics = append(diff.OnlyBaseMetrics, metric)
+			continue
+		}
+		diff.Metrics[metric] = MetricDelta{Base: baseValue, Other: otherValue, Delta: otherValue - baseValue}
+	}
+	for metric, value := range other.Metrics {
+		if _, ok := value.(float64); !ok {
+			continue
+		}
+		if _, ok := base.Metrics[metric].(float64); !ok {
+			diff.OnlyOtherMetrics = append(diff.OnlyOtherMetrics, metric)
+		}
+	}
+	sort.Strings(diff.OnlyBaseMetrics)
+	sort.Strings(diff.OnlyOtherMetrics)
+
+	for key, value := range base.Params {
+		if otherValue := other.Params[key]; otherValue != value {
+			diff.ParamChanges[key] = ParamChange{Base: value, Other: otherValue}
+		}
+	}
+	for key, otherValue := range other.Params {
+		if _, ok := base.Params[key]; !ok {
+			diff.ParamChanges[key] = ParamChange{Other: otherValue}
+		}
+	}
+	return diff
+}
+
+// conceptsByKey returns the concepts of the result by their lemma-normalized form
+func conceptsByKey(result Result) map[string]string {
+	concepts := make(map[string]string)
+	for _, concept := range predictedConcepts(result) {
+		key := conceptKey(concept)
+		if _, ok := concepts[key]; !ok {
+			concepts[key] = concept
+		}
+	}
+	return concepts
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	familyTopicModel         = "topic_model"
+	familyConceptExtraction  = "concept_extraction"
+	familyAcceptanceCriteria = "acceptance_criteria"
+	familyClassification     = "classification"
+)
+
+var methodFamilies = []string{familyTopicModel, familyConceptExtraction, familyAcceptanceCriteria, familyClassification}
+
+// TopicModelOutput model, topics map to their top words, with or without weight, and documents to their topic distribution
+type TopicModelOutput struct {
+	Topics   map[string][]interface{} `json:"topics"`
+	DocTopic map[string][]float64     `json:"doc_topic"`
+	Metrics  map[string]interface{}   `json:"metrics"`
+}
+
+// ConceptExtractionOutput model, the extracted concepts as codes
+type ConceptExtractionOutput struct {
+	Codes   []Code                 `json:"codes"`
+	Metrics map[string]interface{} `json:"metrics"`
+}
+
+// AcceptanceCriteriaOutput model, topics map the user stories to their generated acceptance criteria
+type AcceptanceCriteriaOutput struct {
+	Topics  map[string][]string    `json:"topics"`
+	Metrics map[string]interface{} `json:"metrics"`
+}
+
+// ClassificationOutput model, doc_topic maps the documents to their label
+type ClassificationOutput struct {
+	DocTopic map[string]string      `json:"doc_topic"`
+	Metrics  map[string]interface{} `json:"metrics"`
+}
+
+// MalformedResponseError is returned if the response of a method does not match the output of its family
+type MalformedResponseError struct {
+	Method  string
+	Family  string
+	Reasons []string
+}
+
+func (e *MalformedResponseError) Error() string {
+	return fmt.Sprintf("malformed %s response of method %s: %s", e.Family, e.Method, strings.Join(e.Reasons, "; "))
+}
+
+func isMethodFamily(family string) bool {
+	for _, known := range methodFamilies {
+		if family == known {
+			return true
+		}
+	}
+	return family == ""
+}
+
+// validateMethodResponse checks the response body of a method against the output of its family,
+// responses of methods without family are not checked
+func validateMethodResponse(method MethodConfig, body []byte) error {
+	var reasons []string
+	var metrics map[string]interface{}
+	switch method.Family {
+	case "":
+		return nil
+	case familyTopicModel:
+		var output TopicModelOutput
+		if err := json.Unmarshal(body, &output); err != nil {
+			reasons = append(reasons, err.Error())
+			break
+		}
+		reasons = append(reasons, checkTopicWords(output.Topics)...)
+		for doc, distribution := range output.DocTopic {
+			for i, weight := range distribution {
+				if weight < 0 {
+					reasons = append(reasons, fmt.Sprintf("doc_topic.%s[%d] is negative", doc, i))
+				}
+			}
+		}
+		metrics = output.Metrics
+	case familyConceptExtraction:
+		var output ConceptExtractionOutput
+		if err := json.Unmarshal(body, &output); err != nil {
+			reasons = append(reasons, err.Error())
+			break
+		}
+		if output.Codes == nil {
+			reasons = append(reasons, "codes is missing")
+		}
+		for i, code := range output.Codes {
+			if strings.TrimSpace(code.Name) == "" {
+				reasons = append(reasons, fmt.Sprintf("codes[%d].name is empty", i))
+			}
+			for j, token := range code.Tokens {
+				if token == nil || *token < 0 {
+					reasons = append(reasons, fmt.Sprintf("codes[%d].tokens[%d] is not a token index", i, j))
+				}
+			}
+		}
+		metrics = output.Metrics
+	case familyAcceptanceCriteria:
+		var output AcceptanceCriteriaOutput
+		if err := json.Unmarshal(body, &output); err != nil {
+			reasons = append(reasons, err.Error())
+			break
+		}
+		reasons = append(reasons, checkWordLists("topics", output.Topics, "acceptance criterion")...)
+		metrics = output.Metrics
+	case familyClassification:
+		var output ClassificationOutput
+		if err := json.Unmarshal(body, &output); err != nil {
+			reasons = append(reasons, err.Error())
+			break
+		}
+		if len(output.DocTopic) == 0 {
+			reasons = append(reasons, "doc_topic is empty")
+		}
+		for doc, label := range output.DocTopic {
+			if strings.TrimSpace(label) == "" {
+				reasons = append(reasons, fmt.Sprintf("doc_topic.%s has no label", doc))
+			}
+		}
+		metrics = output.Metrics
+	default:
+		reasons = append(reasons, "unknown method family")
+	}
+
+	for key, value := range metrics {
+		switch value.(type) {
+		case nil, float64, string, bool:
+		default:
+			reasons = append(reasons, fmt.Sprintf("metrics.%s is not a number, string or boolean", key))
+		}
+	}
+	if len(reasons) > 0 {
+		sort.Strings(reasons)
+		return &MalformedResponseError{Method: method.Name, Family: method.Family, Reasons: reasons}
+	}
+	return nil
+}
+
+// checkTopicWords returns why the topics are malformed: none at all, no words, or words that are neither
+// a non-empty string nor a ["word", weight] pair
+func checkTopicWords(topics map[string][]interface{}) []string {
+	var reasons []string
+	if len(topics) == 0 {
+		reasons = append(reasons, "topics is empty")
+	}
+	for topic, words := range topics {
+		if len(words) == 0 {
+			reasons = append(reasons, fmt.Sprintf("topics.%s has no word", topic))
+		}
+		for i, word := range words {
+			if !isTopicWord(word) {
+				reasons = append(reasons, fmt.Sprintf("topics.%s[%d] is not a word or a [word, weight] pair", topic, i))
+			}
+		}
+	}
+	return reasons
+}
+
+func isTopicWord(value interface{}) bool {
+	switch word := value.(type) {
+	case string:
+		return strings.TrimSpace(word) != ""
+	case []interface{}:
+		if len(word) != 2 {
+			return false
+		}
+		text, isText := word[0].(string)
+		_, isWeight := word[1].(float64)
+		return isText && strings.TrimSpace(text) != "" && isWeight
+	}
+	return false
+}
+
+// checkWordLists returns why the lists are malformed: none at all or empty entries
+func checkWordLists(field string, lists map[string][]string, entry string) []string {
+	var reasons []string
+	if len(lists) == 0 {
+		reasons = append(reasons, field+" is empty")
+	}
+	for key, words := range lists {
+		if len(words) == 0 {
+			reasons = append(reasons, fmt.Sprintf("%s.%s has no %s", field, key, entry))
+		}
+		for i, word := range words {
+			if strings.TrimSpace(word) == "" {
+				reasons = append(reasons, fmt.Sprintf("%s.%s[%d] is an empty %s", field, key, i, entry))
+			}
+		}
+	}
+	return reasons
+}
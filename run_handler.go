@@ -0,0 +1,359 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AnalysisKind describes how the requests of a kind of analysis are read, validated and run
+type AnalysisKind struct {
+	Kind       string
+	DatasetKey string
+	NameKey    string
+	// ReservedKeys are request keys of the kind that are not passed to the method as params
+	ReservedKeys []string
+	// RequiredParams must be present in the params in addition to the required params of the method
+	RequiredParams []string
+	// Chunked kinds accept chunk_size and force
+	Chunked bool
+	// Previewable kinds accept preview, the run then only computes what would change
+	Previewable bool
+	// Glossary kinds accept glossary and flag_glossary, the terms of the glossary are protected
+	Glossary bool
+	// Validate checks the fields of the kind, nil if the params are only validated against the method schema
+	Validate func(body map[string]interface{}) []ParamError
+	// DefaultName names the result if the request has no name, nil if the name is required
+	DefaultName func(params map[string]string) string
+	// DryRun returns the requests the run would send
+	DryRun func(run Run) DryRunResponse
+	// Start runs the analysis in the background
+	Start          func(result *Result, run *Run)
+	StartedMessage string
+}
+
+// RelevanceClassificationRequest model, the fields a relevance classification request requires besides method,
+// dataset and name. They are also passed to the method as params
+type RelevanceClassificationRequest struct {
+	Conf              string `json:"relevance_classification_conf"`
+	NewAnnotationName string `json:"new_annotation_name"`
+	NewDatasetName    string `json:"new_dataset_name"`
+}
+
+var relevanceClassificationConfs = []string{"OnlyDataset", "OnlyAnnotation", "AnnotationAndDataset"}
+
+// RunStartedResponse model, the scheduled result of a started analysis
+type RunStartedResponse struct {
+	Status  bool   `json:"status"`
+	Message string `json:"message"`
+	Result  Result `json:"result"`
+}
+
+var detectionAnalysis = AnalysisKind{
+	Kind:         stepKindDetection,
+	DatasetKey:   "dataset",
+	NameKey:      "name",
+	ReservedKeys: []string{datasetModeKey},
+	Chunked:      true,
+	DryRun:       func(run Run) DryRunResponse { return detectionDryRun([]Run{run}) },
+	Start: func(result *Result, run *Run) {
+		_startNewDetection(result, run)
+	},
+	StartedMessage: "Detection started",
+}
+
+var relevanceAnalysis = AnalysisKind{
+	Kind:         stepKindRelevance,
+	DatasetKey:   "original_dataset_name",
+	NameKey:      "run_name",
+	ReservedKeys: []string{"persist", "dataset_persist"},
+	Validate:     validateRelevanceRequest,
+	DefaultName: func(params map[string]string) string {
+		switch params["relevance_classification_conf"] {
+		case "OnlyDataset":
+			return fmt.Sprintf("DatasetName:%s", params["new_dataset_name"])
+		case "OnlyAnnotation":
+			return fmt.Sprintf("AnnotationName:%s", params["new_annotation_name"])
+		case "AnnotationAndDataset":
+			return fmt.Sprintf("DatasetName:%s; AnnotationName:%s", params["new_dataset_name"], params["new_annotation_name"])
+		}
+		return ""
+	},
+	DryRun: func(run Run) DryRunResponse {
+		return DryRunResponse{Status: true, Requests: []DryRunRequest{newDryRunRequest(relevanceClassificationRequest(run))}}
+	},
+	Start: func(result *Result, run *Run) {
+		_startTask(result, func() (map[string]interface{}, error) { return RESTPostStartRelevanceClassification(*run) })
+	},
+	StartedMessage: "Relevance classification started",
+}
+
+var spellcheckAnalysis = AnalysisKind{
+	Kind:           stepKindSpellcheck,
+	DatasetKey:     "original_dataset_name",
+	NameKey:        "run_name",
+	RequiredParams: []string{"new_dataset_name"},
+	Previewable:    true,
+	Glossary:       true,
+	DefaultName: func(params map[string]string) string {
+		return fmt.Sprintf("Spellchecked:%s", params["new_dataset_name"])
+	},
+	DryRun: func(run Run) DryRunResponse {
+		return DryRunResponse{Status: true, Requests: []DryRunRequest{newDryRunRequest(spellcheckingRequest(run))}}
+	},
+	Start: func(result *Result, run *Run) {
+		if run.Preview {
+			_startTask(result, func() (map[string]interface{}, error) { return runSpellcheckPreview(result.Name, *run) })
+			return
+		}
+		_startTask(result, func() (map[string]interface{}, error) {
+			message, err := RESTPostStartSpellchecking(*run)
+			if err == nil && run.FlagGlossary {
+				message = flagGlossaryCorrections(*run, message)
+			}
+			return message, err
+		})
+	},
+	StartedMessage: "Spellchecking started",
+}
+
+// analysisKinds are the kinds of analysis by the kind of their pipeline step
+var analysisKinds = map[string]AnalysisKind{
+	stepKindDetection:  detectionAnalysis,
+	stepKindRelevance:  relevanceAnalysis,
+	stepKindSpellcheck: spellcheckAnalysis,
+}
+
+func postStartNewDetection(w http.ResponseWriter, r *http.Request) {
+	startAnalysis(w, r, detectionAnalysis)
+}
+
+func postStartRelevanceClassification(w http.ResponseWriter, r *http.Request) {
+	startAnalysis(w, r, relevanceAnalysis)
+}
+
+func postStartSpellchecking(w http.ResponseWriter, r *http.Request) {
+	startAnalysis(w, r, spellcheckAnalysis)
+}
+
+// startAnalysis validates the request, stores the scheduled result and runs the analysis in the background
+func startAnalysis(w http.ResponseWriter, r *http.Request, kind AnalysisKind) {
+	var body map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		fmt.Printf("ERROR decoding body: %s, body: %v\n", err, r.Body)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var paramErrors []ParamError
+	method := stringField(body, "method", &paramErrors)
+	datasetName := stringField(body, kind.DatasetKey, &paramErrors)
+	name := stringField(body, kind.NameKey, &paramErrors)
+	owner := stringField(body, ownerKey, &paramErrors)
+	fmt.Printf("start %s called. Method: %v, Dataset: %v\n", kind.Kind, method, datasetName)
+
+	if method == "" && !hasParamError(paramErrors, "method") {
+		paramErrors = append(paramErrors, ParamError{Field: "method", Message: "parameter is required"})
+	}
+	if datasetName == "" && !hasParamError(paramErrors, kind.DatasetKey) {
+		paramErrors = append(paramErrors, ParamError{Field: kind.DatasetKey, Message: "parameter is required"})
+	}
+	callbackURL, callbackErr := parseCallbackURL(body)
+	if callbackErr != nil {
+		paramErrors = append(paramErrors, *callbackErr)
+	}
+	dryRun, dryRunErr := parseDryRun(body)
+	if dryRunErr != nil {
+		paramErrors = append(paramErrors, *dryRunErr)
+	}
+	var chunkSize int
+	var force bool
+	if kind.Chunked {
+		var chunkErr, forceErr *ParamError
+		if chunkSize, chunkErr = parseChunkSize(body); chunkErr != nil {
+			paramErrors = append(paramErrors, *chunkErr)
+		} else if chunkErr = checkChunkable(method, chunkSize); chunkErr != nil {
+			paramErrors = append(paramErrors, *chunkErr)
+		}
+		if force, forceErr = parseForce(body); forceErr != nil {
+			paramErrors = append(paramErrors, *forceErr)
+		}
+	}
+	var preview bool
+	if kind.Previewable {
+		var previewErr *ParamError
+		if preview, previewErr = parseBoolParam(body, previewKey); previewErr != nil {
+			paramErrors = append(paramErrors, *previewErr)
+		}
+	}
+	var protectedTerms []string
+	var flagGlossary bool
+	if kind.Glossary {
+		var glossaryErrors []ParamError
+		protectedTerms, flagGlossary, glossaryErrors = parseGlossary(body)
+		paramErrors = append(paramErrors, glossaryErrors...)
+	}
+
+	// Get parameters and validate them against the kind and the method schema
+	params, methodErrors := kind.validateParams(method, body)
+	paramErrors = append(paramErrors, methodErrors...)
+	if name == "" && kind.DefaultName != nil && len(paramErrors) == 0 {
+		name = kind.DefaultName(params)
+	}
+	// a name that defaults is only missing if the other fields are valid
+	if name == "" && (kind.DefaultName == nil || len(paramErrors) == 0) && !hasParamError(paramErrors, kind.NameKey) {
+		paramErrors = append(paramErrors, ParamError{Field: kind.NameKey, Message: "parameter is required"})
+	}
+	if len(paramErrors) > 0 {
+		respondWithParamErrors(w, paramErrors)
+		return
+	}
+	fmt.Printf("start %s Params: %v\n", kind.Kind, params)
+
+	// Get Dataset from Database, names with the dataset separator are only combined by multi-detections
+	datasets, err := fetchDatasets([]string{datasetName})
+	if err != nil {
+		respondWithDatasetError(w, err)
+		return
+	}
+	dataset := datasets[0]
+
+	run := &Run{Method: method, Params: params, Dataset: dataset, ChunkSize: chunkSize, Force: force, Preview: preview,
+		ProtectedTerms: protectedTerms, FlagGlossary: flagGlossary}
+	if dryRun {
+		respondWithDryRun(w, kind.DryRun(*run))
+		return
+	}
+
+	result := new(Result)
+	result.Method = method
+	result.DatasetName = dataset.Name
+	result.Status = statusScheduled
+	result.StartedAt = time.Now()
+	result.Params = params
+	result.Name = name
+	result.CallbackURL = callbackURL
+	result.Owner = owner
+
+	// Store result object in database (prior to getting results)
+	if err = storeResult(result); err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+	scheduled := *result
+
+	go kind.Start(result, run)
+
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(RunStartedResponse{Status: true, Message: kind.StartedMessage, Result: scheduled})
+}
+
+// validateParams checks the fields of the kind, extracts the method parameters from a request body,
+// validates them against the method schema and checks the required params of the kind
+func (kind AnalysisKind) validateParams(method string, body map[string]interface{}) (map[string]string, []ParamError) {
+	var paramErrors []ParamError
+	if kind.Validate != nil {
+		paramErrors = append(paramErrors, kind.Validate(body)...)
+	}
+	params, methodErrors := analysisParams(kind, method, body)
+	paramErrors = append(paramErrors, methodErrors...)
+	for _, key := range kind.RequiredParams {
+		if value, ok := params[key]; !ok || value == "" {
+			paramErrors = append(paramErrors, ParamError{Field: key, Message: "parameter is required"})
+		}
+	}
+	return params, paramErrors
+}
+
+// analysisParams extracts the method parameters from a request body and validates them
+func analysisParams(kind AnalysisKind, method string, body map[string]interface{}) (map[string]string, []ParamError) {
+	var rawParams = make(map[string]interface{})
+	for key, value := range body {
+		rawParams[key] = value
+	}
+
+	reserved := []string{"method", kind.DatasetKey, kind.NameKey, callbackURLKey, dryRunKey, ownerKey}
+	if kind.Chunked {
+		reserved = append(reserved, chunkSizeKey, forceKey)
+	}
+	if kind.Previewable {
+		reserved = append(reserved, previewKey)
+	}
+	if kind.Glossary {
+		reserved = append(reserved, glossaryKey, flagGlossaryKey)
+	}
+	for _, key := range append(reserved, kind.ReservedKeys...) {
+		delete(rawParams, key)
+	}
+
+	validated, paramErrors := methodRegistry.Resolve(method).Params.Validate(rawParams)
+	return stringifyParams(validated), paramErrors
+}
+
+// stringField returns the string value of key in the body, "" if it is missing or not a string
+func stringField(body map[string]interface{}, key string, paramErrors *[]ParamError) string {
+	value, ok := body[key]
+	if !ok || value == nil {
+		return ""
+	}
+	s, ok := value.(string)
+	if !ok {
+		*paramErrors = append(*paramErrors, ParamError{Field: key, Message: "must be of type string"})
+	}
+	return s
+}
+
+// decodeRelevanceRequest decodes the fields of a relevance classification request, fields that are not strings
+// are reported and stay empty. Method, dataset and name are decoded by startAnalysis
+func decodeRelevanceRequest(body map[string]interface{}) (RelevanceClassificationRequest, []ParamError) {
+	var paramErrors []ParamError
+	request := RelevanceClassificationRequest{
+		Conf:              stringField(body, "relevance_classification_conf", &paramErrors),
+		NewAnnotationName: stringField(body, "new_annotation_name", &paramErrors),
+		NewDatasetName:    stringField(body, "new_dataset_name", &paramErrors),
+	}
+	return request, paramErrors
+}
+
+// validateRelevanceRequest checks that the fields are present strings and the conf is one of relevanceClassificationConfs
+func validateRelevanceRequest(body map[string]interface{}) []ParamError {
+	request, paramErrors := decodeRelevanceRequest(body)
+	required := []struct {
+		field string
+		value string
+	}{
+		{"relevance_classification_conf", request.Conf},
+		{"new_annotation_name", request.NewAnnotationName},
+		{"new_dataset_name", request.NewDatasetName},
+	}
+	for _, param := range required {
+		if param.value == "" && !hasParamError(paramErrors, param.field) {
+			paramErrors = append(paramErrors, ParamError{Field: param.field, Message: "parameter is required"})
+		}
+	}
+	if request.Conf == "" {
+		return paramErrors
+	}
+	for _, conf := range relevanceClassificationConfs {
+		if request.Conf == conf {
+			return paramErrors
+		}
+	}
+	return append(paramErrors, ParamError{
+		Field:   "relevance_classification_conf",
+		Message: "must be one of " + strings.Join(relevanceClassificationConfs, ", "),
+	})
+}
+
+func hasParamError(paramErrors []ParamError, field string) bool {
+	for _, paramError := range paramErrors {
+		if paramError.Field == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultSchedulesFile    = "schedules.json"
+	schedulerInterval       = 30 * time.Second
+	scheduleTimestampFormat = "20060102-1504"
+)
+
+// ScheduleRequest model, creates or replaces the schedule with the given name.
+// If latest_dataset is set, dataset is a name prefix and the most recently uploaded matching dataset is used.
+type ScheduleRequest struct {
+	Name          string                 `json:"name"`
+	Cron          string                 `json:"cron"`
+	Method        string                 `json:"method"`
+	Dataset       string                 `json:"dataset"`
+	LatestDataset bool                   `json:"latest_dataset"`
+	Params        map[string]interface{} `json:"params"`
+	CallbackURL   string                 `json:"callback_url"`
+	Force         bool                   `json:"force"`
+	Owner         string                 `json:"owner"`
+}
+
+// Schedule model, a detection that is started periodically
+type Schedule struct {
+	Name          string            `json:"name"`
+	Cron          string            `json:"cron"`
+	Method        string            `json:"method"`
+	Dataset       string            `json:"dataset"`
+	LatestDataset bool              `json:"latest_dataset"`
+	Params        map[string]string `json:"params"`
+	CallbackURL   string            `json:"callback_url,omitempty"`
+	Force         bool              `json:"force,omitempty"`
+	Owner         string            `json:"owner,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+	NextRun       time.Time         `json:"next_run"`
+	LastRun       *time.Time        `json:"last_run,omitempty"`
+	LastResult    string            `json:"last_result,omitempty"`
+	LastError     string            `json:"last_error,omitempty"`
+}
+
+// ScheduleStore holds all schedules and writes them to its file on every change
+type ScheduleStore struct {
+	mu        sync.Mutex
+	file      jsonFile
+	schedules map[string]*Schedule
+}
+
+// schedules is replaced by the persistent store in main
+var schedules = &ScheduleStore{schedules: make(map[string]*Schedule)}
+
+func schedulesPath() string {
+	path := os.Getenv("SCHEDULES_FILE")
+	if path == "" {
+		pwd, _ := os.Getwd()
+		path = pwd + "/" + defaultSchedulesFile
+	}
+	return path
+}
+
+func loadSchedules(path string) *ScheduleStore {
+	store := &ScheduleStore{file: jsonFile{path: path, kind: "schedules"}, schedules: make(map[string]*Schedule)}
+	var list []*Schedule
+	store.file.load(&list)
+	for _, schedule := range list {
+		store.schedules[schedule.Name] = schedule
+	}
+	log.Printf("Loaded %d schedules from %s\n", len(list), path)
+	return store
+}
+
+// Put adds or replaces a schedule
+func (s *ScheduleStore) Put(schedule Schedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedules[schedule.Name] = &schedule
+	s.save()
+}
+
+// Delete removes a schedule and reports whether it existed
+func (s *ScheduleStore) Delete(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.schedules[name]; !ok {
+		return false
+	}
+	delete(s.schedules, name)
+	s.save()
+	return true
+}
+
+// List returns all schedules sorted by name
+func (s *ScheduleStore) List() []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		list = append(list, *schedule)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Due returns the schedules whose next run is not after now and advances their next run
+func (s *ScheduleStore) Due(now time.Time) []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []Schedule
+	for _, schedule := range s.schedules {
+		if schedule.NextRun.IsZero() || schedule.NextRun.After(now) {
+			continue
+		}
+		cron, err := parseCron(schedule.Cron)
+		if err != nil {
+			continue
+		}
+		lastRun := now
+		schedule.LastRun = &lastRun
+		schedule.NextRun = cron.Next(now)
+		due = append(due, *schedule)
+	}
+	if len(due) > 0 {
+		s.save()
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Name < due[j].Name })
+	return due
+}
+
+func (s *ScheduleStore) update(name string, update func(schedule *Schedule)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if schedule, ok := s.schedules[name]; ok {
+		update(schedule)
+		s.save()
+	}
+}
+
+// save requires the lock
+func (s *ScheduleStore) save() {
+	list := make([]*Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		list = append(list, schedule)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	s.file.save(list)
+}
+
+// runScheduler starts the due schedules every schedulerInterval
+func runScheduler() {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		runDueSchedules(now)
+	}
+}
+
+func runDueSchedules(now time.Time) {
+	for _, schedule := range schedules.Due(now) {
+		go func(schedule Schedule) {
+			_, _ = runSchedule(schedule, now)
+		}(schedule)
+	}
+}
+
+// runSchedule starts the detection of a schedule, the result is named <schedule>-<timestamp>
+func runSchedule(schedule Schedule, at time.Time) (Result, error) {
+	result := new(Result)
+	result.Method = schedule.Method
+	result.Status = statusScheduled
+	result.StartedAt = time.Now()
+	result.Params = schedule.Params
+	result.Name = schedule.Name + "-" + at.Format(scheduleTimestampFormat)
+	result.CallbackURL = schedule.CallbackURL
+	result.Owner = schedule.Owner
+
+	datasetName := schedule.Dataset
+	var err error
+	if schedule.LatestDataset {
+		datasetName, err = latestDatasetName(schedule.Dataset)
+	}
+	var dataset Dataset
+	if err == nil {
+		dataset, err = getDatasets(datasetName)
+	}
+	if err != nil {
+		fmt.Printf("ERROR schedule %s: %s\n", schedule.Name, err)
+		schedules.update(schedule.Name, func(s *Schedule) { s.LastError = err.Error() })
+		return *result, err
+	}
+	result.DatasetName = dataset.Name
+	fmt.Printf("Schedule %s starting detection %s on dataset %s\n", schedule.Name, result.Name, dataset.Name)
+
+	if err = storeResult(result); err != nil {
+		schedules.update(schedule.Name, func(s *Schedule) { s.LastError = err.Error() })
+		return *result, err
+	}
+	schedules.update(schedule.Name, func(s *Schedule) {
+		s.LastResult = result.Name
+		s.LastError = ""
+	})
+
+	run := &Run{Method: schedule.Method, Params: schedule.Params, Dataset: dataset, Force: schedule.Force}
+	return _startNewDetection(result, run), nil
+}
+
+// latestDatasetName returns the name of the most recently uploaded dataset whose name starts with prefix
+func latestDatasetName(prefix string) (string, error) {
+	datasets, err := RESTGetAllDatasets()
+	if err != nil {
+		return "", err
+	}
+	var latest *Dataset
+	for i, dataset := range datasets {
+		if strings.HasPrefix(dataset.Name, prefix) && (latest == nil || dataset.UploadedAt.After(latest.UploadedAt)) {
+			latest = &datasets[i]
+		}
+	}
+	if latest == nil {
+		return "", fmt.Errorf("no dataset starting with %s", prefix)
+	}
+	return latest.Name, nil
+}
+
+// postSchedule creates or replaces a schedule
+func postSchedule(w http.ResponseWriter, r *http.Request) {
+	var request ScheduleRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		fmt.Printf("ERROR decoding body: %s, body: %v\n", err, r.Body)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	fmt.Printf("postSchedule called. Name: %v, Cron: %v\n", request.Name, request.Cron)
+
+	schedule, paramErrors := newSchedule(request, time.Now())
+	if len(paramErrors) > 0 {
+		respondWithParamErrors(w, paramErrors)
+		return
+	}
+	schedules.Put(schedule)
+
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(schedule)
+}
+
+// newSchedule validates the request and computes the first run after now
+func newSchedule(request ScheduleRequest, now time.Time) (Schedule, []ParamError) {
+	var paramErrors []ParamError
+	if request.Name == "" {
+		paramErrors = append(paramErrors, ParamError{Field: "name", Message: "parameter is required"})
+	}
+	if request.Method == "" {
+		paramErrors = append(paramErrors, ParamError{Field: "method", Message: "parameter is required"})
+	}
+	if request.Dataset == "" {
+		paramErrors = append(paramErrors, ParamError{Field: "dataset", Message: "parameter is required"})
+	}
+	if callbackErr := validateCallbackURL(request.CallbackURL); callbackErr != nil {
+		paramErrors = append(paramErrors, *callbackErr)
+	}
+
+	var nextRun time.Time
+	cron, err := parseCron(request.Cron)
+	if err != nil {
+		paramErrors = append(paramErrors, ParamError{Field: "cron", Message: err.Error()})
+	} else if nextRun = cron.Next(now); nextRun.IsZero() {
+		paramErrors = append(paramErrors, ParamError{Field: "cron", Message: "schedule never runs"})
+	}
+
+	validated, runErrors := methodRegistry.Resolve(request.Method).Params.Validate(request.Params)
+	for _, runError := range runErrors {
+		paramErrors = append(paramErrors, ParamError{Field: "params." + runError.Field, Message: runError.Message})
+	}
+	if len(paramErrors) > 0 {
+		return Schedule{}, paramErrors
+	}
+
+	return Schedule{
+		Name:          request.Name,
+		Cron:          request.Cron,
+		Method:        request.Method,
+		Dataset:       request.Dataset,
+		LatestDataset: request.LatestDataset,
+		Params:        stringifyParams(validated),
+		CallbackURL:   request.CallbackURL,
+		Force:         request.Force,
+		Owner:         request.Owner,
+		CreatedAt:     now,
+		NextRun:       nextRun,
+	}, nil
+}
+
+// getSchedules lists all schedules with their next and last run
+func getSchedules(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(schedules.List())
+}
+
+// deleteSchedule removes a schedule, runs that already started are not affected
+func deleteSchedule(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	if !schedules.Delete(name) {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(ResponseMessage{Status: false, Message: "Schedule not found"})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(ResponseMessage{Status: true, Message: "Schedule deleted"})
+}
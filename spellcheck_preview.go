@@ -0,0 +1,388 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	previewKey = "preview"
+	persistKey = "persist"
+
+	previewPending  = "pending"
+	previewAccepted = "accepted"
+
+	changeReplace = "replace"
+	changeInsert  = "insert"
+	changeDelete  = "delete"
+
+	previewRetention = 24 * time.Hour
+	// maxDiffCells bounds the comparison table of a document, larger changes are reported as one replacement
+	maxDiffCells = 1 << 20
+)
+
+// TokenChange model, a change of consecutive tokens, position is the index of the first original token
+type TokenChange struct {
+	Type      string `json:"type"`
+	Position  int    `json:"position"`
+	Original  string `json:"original,omitempty"`
+	Corrected string `json:"corrected,omitempty"`
+	Glossary  bool   `json:"glossary,omitempty"`
+}
+
+// DocumentDiff model, the original and corrected text of a document. Marked is the corrected text
+// with the changes marked as [-original-]{+corrected+}
+type DocumentDiff struct {
+	Id        string        `json:"id"`
+	Number    int           `json:"number"`
+	Original  string        `json:"original"`
+	Corrected string        `json:"corrected"`
+	Changed   bool          `json:"changed"`
+	Changes   []TokenChange `json:"changes"`
+	Marked    string        `json:"marked"`
+	// GlossaryTerms are the protected terms touched by the changes, only set if glossary corrections are flagged
+	GlossaryTerms []string `json:"glossary_terms,omitempty"`
+}
+
+// SpellcheckPreview model, the corrections of a spellchecking that are persisted once accepted
+type SpellcheckPreview struct {
+	Name             string         `json:"name"`
+	Dataset          string         `json:"dataset"`
+	NewDatasetName   string         `json:"new_dataset_name"`
+	Status           string         `json:"status"`
+	ChangedDocuments int            `json:"changed_documents"`
+	Documents        []DocumentDiff `json:"documents"`
+	CreatedAt        time.Time      `json:"created_at"`
+	original         Dataset
+}
+
+// SpellcheckPreviews holds the previews by the name of their result, previews expire after previewRetention
+type SpellcheckPreviews struct {
+	mu       sync.Mutex
+	previews map[string]*SpellcheckPreview
+}
+
+var spellcheckPreviews = &SpellcheckPreviews{previews: make(map[string]*SpellcheckPreview)}
+
+// Put adds or replaces a preview
+func (s *SpellcheckPreviews) Put(preview *SpellcheckPreview) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evict(time.Now())
+	s.previews[preview.Name] = preview
+}
+
+// Get returns a copy of the preview
+func (s *SpellcheckPreviews) Get(name string) (SpellcheckPreview, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evict(time.Now())
+	preview, ok := s.previews[name]
+	if !ok {
+		return SpellcheckPreview{}, false
+	}
+	return *preview, true
+}
+
+// accept marks a pending preview accepted, it returns false if there is no pending preview
+func (s *SpellcheckPreviews) accept(name string) (SpellcheckPreview, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	preview, ok := s.previews[name]
+	if !ok || preview.Status != previewPending {
+		return SpellcheckPreview{}, false
+	}
+	preview.Status = previewAccepted
+	return *preview, true
+}
+
+// Delete removes a preview
+func (s *SpellcheckPreviews) Delete(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.previews, name)
+}
+
+// evict removes the expired previews, the caller must hold the lock
+func (s *SpellcheckPreviews) evict(now time.Time) {
+	for name, preview := range s.previews {
+		if now.Sub(preview.CreatedAt) > previewRetention {
+			delete(s.previews, name)
+		}
+	}
+}
+
+// runSpellcheckPreview asks the spellchecker for the corrections without persisting them and stores the preview.
+// A spellchecker that answers without the corrected documents ignored persist=false and fails the preview.
+func runSpellcheckPreview(name string, run Run) (map[string]interface{}, error) {
+	previewRun := run
+	previewRun.Params = make(map[string]string, len(run.Params)+1)
+	for key, value := range run.Params {
+		previewRun.Params[key] = value
+	}
+	previewRun.Params[persistKey] = "false"
+
+	message, err := RESTPostStartSpellchecking(previewRun)
+	if err != nil {
+		return nil, err
+	}
+	corrected, ok := correctedDocuments(message)
+	if !ok {
+		return nil, &MalformedResponseError{Method: run.Method, Family: "spellcheck preview", Reasons: []string{
+			"no corrected documents, the spellchecker must answer with the documents instead of persisting them if persist is false",
+		}}
+	}
+
+	var protectedTerms []string
+	if run.FlagGlossary {
+		protectedTerms = run.ProtectedTerms
+	}
+	preview := newSpellcheckPreview(name, run.Params["new_dataset_name"], run.Dataset, corrected, protectedTerms)
+	spellcheckPreviews.Put(preview)
+	return map[string]interface{}{
+		"message":           "Spellchecking preview ready",
+		"changed_documents": preview.ChangedDocuments,
+		"documents":         len(preview.Documents),
+	}, nil
+}
+
+// correctedDocuments returns the documents of a spellchecker response
+func correctedDocuments(message map[string]interface{}) ([]Document, bool) {
+	var corrected struct {
+		Documents []Document `json:"documents"`
+	}
+	data, _ := json.Marshal(message)
+	if err := json.Unmarshal(data, &corrected); err != nil || corrected.Documents == nil {
+		return nil, false
+	}
+	return corrected.Documents, true
+}
+
+// newSpellcheckPreview compares every document of the dataset with its corrected version, matched by id,
+// and flags the changes that touched the protected terms
+func newSpellcheckPreview(name string, newDatasetName string, dataset Dataset, corrected []Document, protectedTerms []string) *SpellcheckPreview {
+	correctedTexts := make(map[string]string, len(corrected))
+	for _, document := range corrected {
+		correctedTexts[document.Id] = document.Text
+	}
+
+	preview := &SpellcheckPreview{
+		Name:           name,
+		Dataset:        dataset.Name,
+		NewDatasetName: newDatasetName,
+		Status:         previewPending,
+		Documents:      []DocumentDiff{},
+		CreatedAt:      time.Now(),
+		original:       dataset,
+	}
+	for _, document := range dataset.Documents {
+		text, ok := correctedTexts[document.Id]
+		if !ok {
+			text = document.Text
+		}
+		tokens := strings.Fields(document.Text)
+		changes, marked := diffTokens(tokens, strings.Fields(text))
+		diff := DocumentDiff{
+			Id:        document.Id,
+			Number:    document.Number,
+			Original:  document.Text,
+			Corrected: text,
+			Changed:   len(changes) > 0,
+			Changes:   changes,
+			Marked:    marked,
+		}
+		if len(protectedTerms) > 0 {
+			diff.GlossaryTerms = markGlossaryChanges(tokens, diff.Changes, protectedTerms)
+		}
+		if diff.Changed {
+			preview.ChangedDocuments++
+		}
+		preview.Documents = append(preview.Documents, diff)
+	}
+	return preview
+}
+
+// diffTokens returns the changes between the original and corrected tokens (longest common subsequence)
+// and the corrected text with the changes marked. The common prefix and suffix are skipped before comparing.
+func diffTokens(original []string, corrected []string) ([]TokenChange, string) {
+	prefix := 0
+	for prefix < len(original) && prefix < len(corrected) && original[prefix] == corrected[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(original)-prefix && suffix < len(corrected)-prefix &&
+		original[len(original)-1-suffix] == corrected[len(corrected)-1-suffix] {
+		suffix++
+	}
+	changedOriginal := original[prefix : len(original)-suffix]
+	changedCorrected := corrected[prefix : len(corrected)-suffix]
+	lcs := lcsTable(changedOriginal, changedCorrected)
+
+	changes := []TokenChange{}
+	marked := append([]string{}, original[:prefix]...)
+	var removed, added []string
+	position := prefix
+	flush := func() {
+		if len(removed) == 0 && len(added) == 0 {
+			return
+		}
+		change := TokenChange{Position: position, Original: strings.Join(removed, " "), Corrected: strings.Join(added, " ")}
+		switch {
+		case len(removed) == 0:
+			change.Type = changeInsert
+			marked = append(marked, "{+"+change.Corrected+"+}")
+		case len(added) == 0:
+			change.Type = changeDelete
+			marked = append(marked, "[-"+change.Original+"-]")
+		default:
+			change.Type = changeReplace
+			marked = append(marked, "[-"+change.Original+"-]{+"+change.Corrected+"+}")
+		}
+		changes = append(changes, change)
+		removed, added = nil, nil
+	}
+
+	i, j := 0, 0
+	for i < len(changedOriginal) || j < len(changedCorrected) {
+		switch {
+		case lcs != nil && i < len(changedOriginal) && j < len(changedCorrected) && changedOriginal[i] == changedCorrected[j]:
+			flush()
+			marked = append(marked, changedOriginal[i])
+			i++
+			j++
+			position = prefix + i
+		case j < len(changedCorrected) && (i == len(changedOriginal) || lcs != nil && lcs[i][j+1] >= lcs[i+1][j]):
+			added = append(added, changedCorrected[j])
+			j++
+		default:
+			removed = append(removed, changedOriginal[i])
+			i++
+		}
+	}
+	flush()
+	marked = append(marked, original[len(original)-suffix:]...)
+	return changes, strings.Join(marked, " ")
+}
+
+// lcsTable returns the lengths of the longest common subsequences, lcs[i][j] for original[i:] and corrected[j:],
+// or nil if the table would exceed maxDiffCells
+func lcsTable(original []string, corrected []string) [][]int {
+	if (len(original)+1)*(len(corrected)+1) > maxDiffCells {
+		return nil
+	}
+	lcs := make([][]int, len(original)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(corrected)+1)
+	}
+	for i := len(original) - 1; i >= 0; i-- {
+		for j := len(corrected) - 1; j >= 0; j-- {
+			if original[i] == corrected[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	return lcs
+}
+
+// getSpellcheckPreview returns the per document diffs of a spellchecking preview
+func getSpellcheckPreview(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	preview, ok := spellcheckPreviews.Get(name)
+
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(ResponseMessage{Status: false, Message: "Preview not found"})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(preview)
+}
+
+// postAcceptSpellcheckPreview persists the new dataset with the corrections of all or the given documents
+func postAcceptSpellcheckPreview(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	var body struct {
+		Documents []string `json:"documents"`
+	}
+	// an empty body accepts all documents
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		fmt.Printf("ERROR decoding body: %s, body: %v\n", err, r.Body)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	fmt.Printf("postAcceptSpellcheckPreview called. Preview: %v, Documents: %v\n", name, body.Documents)
+
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	preview, ok := spellcheckPreviews.Get(name)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(ResponseMessage{Status: false, Message: "Preview not found"})
+		return
+	}
+
+	accepted := make(map[string]bool)
+	known := make(map[string]bool)
+	for _, diff := range preview.Documents {
+		known[diff.Id] = true
+		if body.Documents == nil {
+			accepted[diff.Id] = true
+		}
+	}
+	var paramErrors []ParamError
+	for i, id := range body.Documents {
+		if !known[id] {
+			paramErrors = append(paramErrors, ParamError{Field: fmt.Sprintf("documents[%d]", i), Message: "unknown document " + id})
+		}
+		accepted[id] = true
+	}
+	if len(paramErrors) > 0 {
+		respondWithParamErrors(w, paramErrors)
+		return
+	}
+
+	if preview, ok = spellcheckPreviews.accept(name); !ok {
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(ResponseMessage{Status: false, Message: "Preview was already accepted"})
+		return
+	}
+
+	dataset := Dataset{Name: preview.NewDatasetName, UploadedAt: time.Now()}
+	corrections := 0
+	for i, document := range preview.original.Documents {
+		diff := preview.Documents[i]
+		if accepted[diff.Id] && diff.Changed {
+			document.Text = diff.Corrected
+			corrections++
+		}
+		dataset.Documents = append(dataset.Documents, document)
+	}
+	dataset.Size = len(dataset.Documents)
+
+	if err := RESTPostStoreDataset(dataset); err != nil {
+		fmt.Printf("ERROR storing spellchecked dataset %s: %s\n", dataset.Name, err)
+		preview.Status = previewPending
+		spellcheckPreviews.Put(&preview)
+		w.WriteHeader(http.StatusBadGateway)
+		_ = json.NewEncoder(w).Encode(ResponseMessage{Status: false, Message: "Error saving dataset"})
+		return
+	}
+	spellcheckPreviews.Delete(name)
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(ResponseMessage{
+		Status:  true,
+		Message: fmt.Sprintf("Dataset %s stored with %d corrected documents", dataset.Name, corrections),
+	})
+}
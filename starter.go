@@ -26,6 +26,8 @@ import (
 const (
 	contentTypeKey     = "Content-Type"
 	contentTypeValJSON = "application/json"
+
+	taskResponseMetricKey = "response"
 )
 
 func main() {
@@ -36,6 +38,11 @@ func main() {
 
 	router := makeRouter()
 
+	recoverJobs(jobJournalPath())
+	schedules = loadSchedules(schedulesPath())
+	glossaries = loadGlossaries(glossariesPath())
+	go runScheduler()
+
 	fmt.Println("uvl-orchestration-concepts MS running")
 	log.Fatal(http.ListenAndServe(":9709", handlers.CORS(allowedHeaders, allowedOrigins, allowedMethods)(router)))
 }
@@ -54,6 +61,25 @@ func makeRouter() *mux.Router {
 	router.HandleFunc("/hitec/orchestration/concepts/multidetection/", postStartNewMultiDetection).Methods("POST")
 	router.HandleFunc("/hitec/orchestration/concepts/relevance/", postStartRelevanceClassification).Methods("POST")
 	router.HandleFunc("/hitec/orchestration/concepts/spellchecker/", postStartSpellchecking).Methods("POST")
+	router.HandleFunc("/hitec/orchestration/concepts/spellchecker/preview/{name}/", getSpellcheckPreview).Methods("GET")
+	router.HandleFunc("/hitec/orchestration/concepts/spellchecker/preview/{name}/accept/", postAcceptSpellcheckPreview).Methods("POST")
+	router.HandleFunc("/hitec/orchestration/concepts/glossaries/", postGlossary).Methods("POST")
+	router.HandleFunc("/hitec/orchestration/concepts/glossaries/", getGlossaries).Methods("GET")
+	router.HandleFunc("/hitec/orchestration/concepts/glossaries/{name}/", deleteGlossary).Methods("DELETE")
+	router.HandleFunc("/hitec/orchestration/concepts/pipeline/", postStartPipeline).Methods("POST")
+	router.HandleFunc("/hitec/orchestration/concepts/sweep/", postStartSweep).Methods("POST")
+	router.HandleFunc("/hitec/orchestration/concepts/sweep/{name}/", getSweep).Methods("GET")
+	router.HandleFunc("/hitec/orchestration/concepts/ensemble/", postStartEnsemble).Methods("POST")
+	router.HandleFunc("/hitec/orchestration/concepts/evaluation/", postEvaluateResult).Methods("POST")
+	router.HandleFunc("/hitec/orchestration/concepts/methods/", getMethods).Methods("GET")
+	router.HandleFunc("/hitec/orchestration/concepts/methods/load/", getMethodLoad).Methods("GET")
+	router.HandleFunc("/hitec/orchestration/concepts/events/", getJobEvents).Methods("GET")
+	router.HandleFunc("/hitec/orchestration/concepts/status/", getStatus).Methods("GET")
+	router.HandleFunc("/hitec/orchestration/concepts/results/diff/", getResultDiff).Methods("GET")
+	router.HandleFunc("/hitec/orchestration/concepts/results/{name}/cancel/", postCancelResult).Methods("POST")
+	router.HandleFunc("/hitec/orchestration/concepts/schedules/", postSchedule).Methods("POST")
+	router.HandleFunc("/hitec/orchestration/concepts/schedules/", getSchedules).Methods("GET")
+	router.HandleFunc("/hitec/orchestration/concepts/schedules/{name}/", deleteSchedule).Methods("DELETE")
 	return router
 }
 
@@ -233,283 +259,129 @@ func postAddGroundTruth(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
-func postStartRelevanceClassification(w http.ResponseWriter, r *http.Request) {
+func postStartNewMultiDetection(w http.ResponseWriter, r *http.Request) {
 
 	var body map[string]interface{}
-
 	err := json.NewDecoder(r.Body).Decode(&body)
 	if err != nil {
 		fmt.Printf("ERROR decoding body: %s, body: %v\n", err, r.Body)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-
-	runName := body["run_name"].(string)
-	methodName := body["method"].(string)
-	datasetName := body["original_dataset_name"].(string)
-
-	// Get Dataset from Database
-	dataset, err := RESTGetDataset(datasetName)
-	handleErrorWithResponse(w, err, "ERROR retrieving dataset")
-
-	// Get parameters
-	var params = make(map[string]string)
-	for key, value := range body {
-		s := fmt.Sprintf("%v", value)
-		params[key] = s
+	fmt.Println("body: ")
+	fmt.Printf("%+v\n", body)
+	datasetList, _ := body["dataset"].(string)
+	if datasetList == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(ResponseMessage{Status: true, Message: "Cannot start detection with no dataset."})
+		return
 	}
-	delete(params, "original_dataset_name")
-	delete(params, "persist")
-	delete(params, "dataset_persist")
-	delete(params, "run_name")
+	method, _ := body["method"].(string)
+	fmt.Printf("postStartNewMultiDetection called. Method: %v, Dataset: %v\n", method, datasetList)
 
-	run := new(Run)
-	run.Method = methodName
-	run.Params = params
-	run.Dataset = dataset
+	name, _ := body["name"].(string)
 
-	relevanceClassificationConf, exists := params["relevance_classification_conf"]
-	if !exists {
-		fmt.Println("relevance_classification_conf key does not exist in params")
-		return
+	datasetMode, _ := body[datasetModeKey].(string)
+	if datasetMode == "" {
+		datasetMode = datasetModeCombined
 	}
-
-	newAnnotationName, exists := params["new_annotation_name"]
-	if !exists {
-		fmt.Println("new_annotation_name key does not exist in params")
+	if datasetMode != datasetModeCombined && datasetMode != datasetModePerDataset {
+		respondWithParamErrors(w, []ParamError{{Field: datasetModeKey, Message: "must be one of combined, per_dataset"}})
 		return
 	}
 
-	newDatasetName, exists := params["new_dataset_name"]
-	if !exists {
-		fmt.Println("new_dataset_name key does not exist in params")
+	callbackURL, callbackErr := parseCallbackURL(body)
+	if callbackErr != nil {
+		respondWithParamErrors(w, []ParamError{*callbackErr})
 		return
 	}
 
-	if runName == "" {
-		// Generate the appropriate string based on the value of relevance_classification_conf
-		var name string
-		switch relevanceClassificationConf {
-		case "OnlyDataset":
-			name = fmt.Sprintf("DatasetName:%s", newDatasetName)
-		case "OnlyAnnotation":
-			name = fmt.Sprintf("AnnotationName:%s", newAnnotationName)
-		case "AnnotationAndDataset":
-			name = fmt.Sprintf("DatasetName:%s; AnnotationName:%s", newDatasetName, newAnnotationName)
-		}
-		runName = name
+	chunkSize, chunkErr := parseChunkSize(body)
+	if chunkErr == nil {
+		chunkErr = checkChunkable(method, chunkSize)
 	}
-
-	result := new(Result)
-	result.Method = methodName
-	result.DatasetName = dataset.Name
-	result.Status = "scheduled"
-	result.StartedAt = time.Now()
-	result.Params = params
-	result.Name = runName
-
-	// Store result object in database (prior to getting results)
-	err = RESTPostStoreResult(*result)
-	handleErrorWithResponse(w, err, "Error saving relevance result to database")
-
-	message, err := RESTPostStartRelevanceClassification(*run)
-	if err != nil {
-		log.Printf("ERROR making RESTPostStartRelevanceClassification request: %v\n", err)
-		result.Status = "failed"
-		_ = RESTPostStoreResult(*result)
-
-		responseString := map[string]string{"message": "Creation failed!"}
-
-		jsonResponseString, jsonErr := json.Marshal(responseString)
-		if jsonErr != nil {
-			log.Printf("ERROR marshalling response message to JSON: %v\n", jsonErr)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(jsonResponseString)
+	if chunkErr != nil {
+		respondWithParamErrors(w, []ParamError{*chunkErr})
 		return
 	}
 
-	fmt.Printf("Relevance Classification Message Response: %v\n", message)
-
-	result.Status = "finished"
-
-	err = RESTPostStoreResult(*result)
-	if err != nil {
-		fmt.Printf("ERROR storing final relevance result %s\n", err)
-		panic(err)
-	}
-
-	// Convert the message map back to JSON
-	responseData, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("ERROR marshalling response data: %v\n", err)
-		w.WriteHeader(http.StatusInternalServerError)
+	force, forceErr := parseForce(body)
+	if forceErr != nil {
+		respondWithParamErrors(w, []ParamError{*forceErr})
 		return
 	}
 
-	// Write the response message back to the client
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseData)
-
-}
-
-func postStartSpellchecking(w http.ResponseWriter, r *http.Request) {
-
-	var body map[string]interface{}
-
-	err := json.NewDecoder(r.Body).Decode(&body)
-	if err != nil {
-		fmt.Printf("ERROR decoding body: %s, body: %v\n", err, r.Body)
-		w.WriteHeader(http.StatusBadRequest)
+	dryRun, dryRunErr := parseDryRun(body)
+	if dryRunErr != nil {
+		respondWithParamErrors(w, []ParamError{*dryRunErr})
 		return
 	}
 
-	runName := body["run_name"].(string)
-	methodName := body["method"].(string)
-	datasetName := body["original_dataset_name"].(string)
-
-	// Get Dataset from Database
-	dataset, err := RESTGetDataset(datasetName)
-	handleErrorWithResponse(w, err, "ERROR retrieving dataset")
-
-	// Get parameters
-	var params = make(map[string]string)
-	for key, value := range body {
-		s := fmt.Sprintf("%v", value)
-		params[key] = s
+	// Get parameters and validate them against the method schema
+	params, paramErrors := analysisParams(detectionAnalysis, method, body)
+	if len(paramErrors) > 0 {
+		respondWithParamErrors(w, paramErrors)
+		return
 	}
 
-	delete(params, "method")
-
-	run := new(Run)
-	run.Method = methodName
-	run.Params = params
-	run.Dataset = dataset
-
-	newDatasetName, exists := params["new_dataset_name"]
-	if !exists {
-		fmt.Println("new_dataset_name key does not exist in params")
+	// Get Datasets from Database
+	datasets, err := fetchDatasets(strings.Split(datasetList, datasetSeparator))
+	if err != nil {
+		respondWithDatasetError(w, err)
 		return
 	}
+	allDataSets := combineDatasets(datasetList, datasets)
 
-	if runName == "" {
-		// Generate a default name for the spellchecker run
-		var name string
-		name = fmt.Sprintf("Spellchecked:%s", newDatasetName)
-		runName = name
-	}
+	fmt.Printf("postStartNewDetection Params: %v\n", params)
 
 	result := new(Result)
-	result.Method = methodName
-	result.DatasetName = dataset.Name
-	result.Status = "scheduled"
+	result.Method = method
+	result.DatasetName = datasetList
+	result.Status = statusScheduled
 	result.StartedAt = time.Now()
 	result.Params = params
-	result.Name = runName
-
-	// Store result object in database (prior to getting results)
-	err = RESTPostStoreResult(*result)
-	handleErrorWithResponse(w, err, "Error saving spellchecker result to database")
-
-	message, err := RESTPostStartSpellchecking(*run)
-	if err != nil {
-		log.Printf("ERROR making RESTPostStartSpellchecking request: %v\n", err)
-		result.Status = "failed"
-		_ = RESTPostStoreResult(*result)
-
-		responseString := map[string]string{"message": "Creation failed!"}
+	result.Name = name
+	result.CallbackURL = callbackURL
+	result.Owner, _ = body[ownerKey].(string)
 
-		jsonResponseString, jsonErr := json.Marshal(responseString)
-		if jsonErr != nil {
-			log.Printf("ERROR marshalling response message to JSON: %v\n", jsonErr)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
+	if datasetMode == datasetModePerDataset && dryRun {
+		var runs []Run
+		for _, dataset := range datasets {
+			runs = append(runs, Run{Method: method, Params: params, Dataset: dataset, ChunkSize: chunkSize, Force: force})
 		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(jsonResponseString)
-		return
-	}
-
-	fmt.Printf("Spellchecker Message Response: %v\n", message)
-
-	result.Status = "finished"
-
-	err = RESTPostStoreResult(*result)
-	if err != nil {
-		fmt.Printf("ERROR storing final spellchecker result %s\n", err)
-		panic(err)
-	}
-
-	// Convert the message map back to JSON
-	responseData, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("ERROR marshalling response data: %v\n", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		respondWithDryRun(w, detectionDryRun(runs))
 		return
 	}
+	if datasetMode == datasetModePerDataset {
+		for _, dataset := range datasets {
+			result.Children = append(result.Children, name+"/"+dataset.Name)
+		}
+		if err = storeResult(result); err != nil {
+			respondWithStoreError(w, err)
+			return
+		}
+		go _startPerDatasetDetection(result, Run{Method: method, Params: params, ChunkSize: chunkSize, Force: force}, datasets)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseData)
-
-}
-
-func postStartNewDetection(w http.ResponseWriter, r *http.Request) {
-
-	var body map[string]interface{}
-	err := json.NewDecoder(r.Body).Decode(&body)
-	if err != nil {
-		fmt.Printf("ERROR decoding body: %s, body: %v\n", err, r.Body)
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-	datasetName := body["dataset"].(string)
-	if datasetName == "" {
-		_ = json.NewEncoder(w).Encode(ResponseMessage{Status: true, Message: "Cannot start detection with no dataset."})
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(ResponseMessage{Status: true, Message: "Detection started"})
 		return
 	}
-	method := body["method"].(string)
-	fmt.Printf("postStartNewDetection called. Method: %v, Dataset: %v\n", method, datasetName)
-
-	name := body["name"].(string)
-
-	// Get Dataset from Database
-	dataset, err := RESTGetDataset(datasetName)
-	handleErrorWithResponse(w, err, "ERROR retrieving dataset")
-
-	// Get parameters
-	var params = make(map[string]string)
-	for key, value := range body {
-		s := fmt.Sprintf("%v", value)
-		params[key] = s
-	}
-
-	delete(params, "method")
-	delete(params, "dataset")
-	delete(params, "name")
-
-	fmt.Printf("postStartNewDetection Params: %v\n", params)
-
-	result := new(Result)
-	result.Method = method
-	result.DatasetName = dataset.Name
-	result.Status = "scheduled"
-	result.StartedAt = time.Now()
-	result.Params = params
-	result.Name = name
 
 	run := new(Run)
 	run.Method = method
 	run.Params = params
-	run.Dataset = dataset
+	run.Dataset = allDataSets
+	run.ChunkSize = chunkSize
+	run.Force = force
+	if dryRun {
+		respondWithDryRun(w, detectionDryRun([]Run{*run}))
+		return
+	}
 	// Store result object in database (prior to getting results)
-	err = RESTPostStoreResult(*result)
-	handleErrorWithResponse(w, err, "Error saving to database")
-
+	if err = storeResult(result); err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
 	go _startNewDetection(result, run)
 
 	w.WriteHeader(http.StatusOK)
@@ -517,111 +389,91 @@ func postStartNewDetection(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
-func postStartNewMultiDetection(w http.ResponseWriter, r *http.Request) {
+// _startTask runs a relevance classification or spellchecking in the background, the response
+// message of the service is stored in the metrics of the result
+func _startTask(result *Result, call func() (map[string]interface{}, error)) Result {
+	result.Status = statusStarted
+	if err := storeResult(result); isInvalidTransition(err) {
+		logJob(*result, "not starting %s: %s", result.Method, err)
+		result.Status = resultStates.status(result.Name)
+		return *result
+	}
+	jobJournal.StartTask(*result)
 
-	var body map[string]interface{}
-	err := json.NewDecoder(r.Body).Decode(&body)
+	logJob(*result, "calling %s and waiting for response", result.Method)
+	message, err := call()
 	if err != nil {
-		fmt.Printf("ERROR decoding body: %s, body: %v\n", err, r.Body)
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-	fmt.Println("body: ")
-	fmt.Printf("%+v\n", body)
-	//var datasetList []string
-	datasetList := body["dataset"].(string)
-	if datasetList == "" {
-		_ = json.NewEncoder(w).Encode(ResponseMessage{Status: true, Message: "Cannot start detection with no dataset."})
-		w.WriteHeader(http.StatusBadRequest)
-		return
+		logJob(*result, "ERROR with %s %s", result.Method, err)
+		result.fail(err, errorCategoryMethod)
+	} else {
+		logJob(*result, "response received: %v", message)
+		result.Status = statusFinished
+		result.Metrics = map[string]interface{}{taskResponseMetricKey: message}
 	}
-	var datasets = strings.Split(datasetList, "#!#")
-	method := body["method"].(string)
-	fmt.Printf("postStartNewMultiDetection called. Method: %v, Dataset: %v\n", method, datasetList)
-
-	name := body["name"].(string) //TODO: Check if nil
 
-	var allDataSets Dataset
-	allDataSets.Name = datasetList
-	// Get Datasets from Database
-	for _, datasetName := range datasets {
-		dataset, err := RESTGetDataset(datasetName)
-		allDataSets.Documents = append(allDataSets.Documents, dataset.Documents...)
-		handleErrorWithResponse(w, err, "ERROR retrieving dataset "+datasetName)
+	err = storeResult(result)
+	if isInvalidTransition(err) {
+		logJob(*result, "discarding the response: %s", err)
+		return *result
 	}
-	allDataSets.Size = len(allDataSets.Documents)
-
-	// Get parameters
-	var params = make(map[string]string)
-	for key, value := range body {
-		s := fmt.Sprintf("%v", value)
-		params[key] = s
+	if err != nil {
+		logJob(*result, "ERROR storing final result %s", err)
+		result.fail(err, errorCategoryStorage)
 	}
-
-	delete(params, "method")
-	delete(params, "dataset")
-	delete(params, "name")
-
-	fmt.Printf("postStartNewDetection Params: %v\n", params)
-
-	result := new(Result)
-	result.Method = method
-	result.DatasetName = datasetList
-	result.Status = "scheduled"
-	result.StartedAt = time.Now()
-	result.Params = params
-	result.Name = name
-
-	run := new(Run)
-	run.Method = method
-	run.Params = params
-	run.Dataset = allDataSets
-	fmt.Println("params")
-	fmt.Println(run)
-	fmt.Println(params)
-	// Store result object in database (prior to getting results)
-	err = RESTPostStoreResult(*result)
-	handleErrorWithResponse(w, err, "Error saving to database")
-	fmt.Println("result")
-	fmt.Println(result)
-	fmt.Println("---")
-	_startNewDetection(result, run)
-
-	w.WriteHeader(http.StatusOK)
-	_ = json.NewEncoder(w).Encode(ResponseMessage{Status: true, Message: "Detection finished"})
-	return
+	notifyCallback(*result)
+	return *result
 }
 
-func _startNewDetection(result *Result, run *Run) {
+// _startNewDetection runs the detection and returns the final result
+func _startNewDetection(result *Result, run *Run) Result {
 
 	// Change status and save it to database
-	result.Status = "started"
-	_ = RESTPostStoreResult(*result)
+	result.Status = statusStarted
+	if err := storeResult(result); isInvalidTransition(err) {
+		logJob(*result, "not starting detection: %s", err)
+		result.Status = resultStates.status(result.Name)
+		return *result
+	}
+	jobJournal.StartDetection(*result, *run)
 
 	// Call detection MS
-	fmt.Printf("_startNewDetection, calling MS and waiting for response\n")
-	fmt.Println(*run)
-	endResult, err := RESTPostStartNewDetection(*result, *run)
+	logJob(*result, "calling %s on %d documents and waiting for response", run.Method, len(run.Dataset.Documents))
+	endResult, err := runCachedDetection(*result, *run)
 	if err != nil {
-		fmt.Printf("ERROR with detection %s\n", err)
-		endResult.Status = "failed"
-		_ = RESTPostStoreResult(endResult)
-		return
+		logJob(*result, "ERROR with detection %s", err)
+		endResult.fail(err, errorCategoryMethod)
+		if err = storeResult(&endResult); isInvalidTransition(err) {
+			return endResult
+		}
+		notifyCallback(endResult)
+		return endResult
 	}
 
-	endResult.Status = "finished"
+	endResult.Status = statusFinished
+
+	// Evaluate against the ground truth of the dataset
+	if len(run.Dataset.GroundTruth) > 0 {
+		if endResult.Metrics == nil {
+			endResult.Metrics = make(map[string]interface{})
+		}
+		endResult.Metrics[evaluationMetricKey] = evaluateResult(endResult, run.Dataset)
+	}
 
 	// Store results in database
+	logJob(endResult, "response received, %d topics, %d codes", len(endResult.Topics), len(endResult.Codes))
 	fmt.Printf("Response received, Topics: %s\n", endResult.Topics)
-	fmt.Printf("Response received, Codes: %s\n", endResult.Codes)
-	fmt.Printf("%#v", endResult)
-	err = RESTPostStoreResult(endResult)
+	fmt.Printf("Response received, Codes: %v\n", endResult.Codes)
+	err = storeResult(&endResult)
+	if isInvalidTransition(err) {
+		logJob(endResult, "discarding the response: %s", err)
+		return endResult
+	}
 	if err != nil {
-		fmt.Printf("ERROR storing final result %s\n", err)
-		panic(err)
+		logJob(endResult, "ERROR storing final result %s", err)
+		endResult.fail(err, errorCategoryStorage)
 	}
-
-	// What to do when storing the result fails?
+	notifyCallback(endResult)
+	return endResult
 }
 
 func createKeyValuePairs(m map[string]interface{}) string {
@@ -813,19 +665,12 @@ func exportAgreementAsAnnotation(w http.ResponseWriter, r *http.Request) {
 
 // postAnnotationTokenize Tokenize a document and return the result
 func getNewAnnotation(w http.ResponseWriter, datasetName string, sentenceTokenizationEnabledForAnnotation bool) ([]byte, error) {
-	var datasets = strings.Split(datasetName, "#!#")
-	var allDataSets Dataset
-	allDataSets.Name = datasetName
 	// Get Datasets from Database
-	for _, datasetName := range datasets {
-		dataset, err := RESTGetDataset(datasetName)
-		allDataSets.Documents = append(allDataSets.Documents, dataset.Documents...)
-		handleErrorWithResponse(w, err, "ERROR retrieving dataset "+datasetName)
-		if err != nil {
-			return *new([]byte), err
-		}
+	allDataSets, err := getDatasets(datasetName)
+	if err != nil {
+		respondWithDatasetError(w, err)
+		return *new([]byte), err
 	}
-	allDataSets.Size = len(allDataSets.Documents)
 
 	log.Printf("Tokenizing: " + datasetName)
 
@@ -841,15 +686,13 @@ func getNewAnnotation(w http.ResponseWriter, datasetName string, sentenceTokeniz
 	req, _ := createRequest(POST, url, requestBody)
 
 	res, err := client.Do(req)
-
-	defer res.Body.Close()
-
 	if err != nil {
 		log.Printf("ERR getting tokens for annotation %v\n", err)
 		log.Printf("Note: If the request timed out, the method microservice may take too long to process the" +
 			" request. Consider increasing timeout in rest_handler->getHTTPClient.")
 		return *new([]byte), err
 	}
+	defer res.Body.Close()
 
 	w.WriteHeader(res.StatusCode)
 
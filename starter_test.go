@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
@@ -10,7 +11,11 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -23,6 +28,18 @@ var stopTestServer func()
 var documents []Document
 var mockDataset Dataset
 var mockResult Result
+var mockTruthDataset = Dataset{
+	Name: "truth",
+	Documents: []Document{
+		{Number: 0, Id: "0", Text: "The user interface is slow."},
+		{Number: 1, Id: "1", Text: "I cannot login with my accounts."},
+	},
+	GroundTruth: []TruthElement{
+		{Id: "0", Value: "user interface"},
+		{Id: "1", Value: "login"},
+		{Id: "1", Value: "account"},
+	},
+}
 var invalidPayloadString = "payload"
 var invalidPayload []byte
 
@@ -105,6 +122,37 @@ func mockStorageConcepts(r *mux.Router) {
 	r.HandleFunc("/hitec/repository/concepts/dataset/name/test", func(w http.ResponseWriter, request *http.Request) {
 		respond(w, http.StatusOK, mockDataset)
 	})
+	r.HandleFunc("/hitec/repository/concepts/dataset/name/truth", func(w http.ResponseWriter, request *http.Request) {
+		respond(w, http.StatusOK, mockTruthDataset)
+	})
+	r.HandleFunc("/hitec/repository/concepts/detection/result/name/evaluated", func(w http.ResponseWriter, request *http.Request) {
+		respond(w, http.StatusOK, Result{Name: "evaluated", Status: statusFinished, DatasetName: "truth", Codes: []Code{{Name: "user interfaces"}, {Name: "login"}}})
+	})
+	r.HandleFunc("/hitec/repository/concepts/detection/result/name/evaluated_running", func(w http.ResponseWriter, request *http.Request) {
+		respond(w, http.StatusOK, Result{Name: "evaluated_running", Status: statusStarted, DatasetName: "truth"})
+	})
+	r.HandleFunc("/hitec/repository/concepts/detection/result/name/diff_base", func(w http.ResponseWriter, request *http.Request) {
+		respond(w, http.StatusOK, Result{Name: "diff_base", DatasetName: "test", Params: map[string]string{"alpha": "0.1"},
+			Codes:   []Code{{Name: "user interfaces"}, {Name: "login"}},
+			Topics:  map[string]interface{}{"0": []interface{}{"login", "account"}},
+			Metrics: map[string]interface{}{"coherence": 0.5, "perplexity": 10.0, "model": "lda"}})
+	})
+	r.HandleFunc("/hitec/repository/concepts/detection/result/name/diff_other", func(w http.ResponseWriter, request *http.Request) {
+		respond(w, http.StatusOK, Result{Name: "diff_other", DatasetName: "test", Params: map[string]string{"alpha": "0.2"},
+			Codes:   []Code{{Name: "User interface"}, {Name: "crash"}},
+			Topics:  map[string]interface{}{"a": []interface{}{"accounts", "crash"}},
+			Metrics: map[string]interface{}{"coherence": 0.75, "model": "lda"}})
+	})
+	r.HandleFunc("/hitec/repository/concepts/detection/result/name/sweep/run-1", func(w http.ResponseWriter, request *http.Request) {
+		respond(w, http.StatusOK, Result{Name: request.URL.EscapedPath()})
+	})
+	r.HandleFunc("/hitec/repository/concepts/dataset/all", func(w http.ResponseWriter, request *http.Request) {
+		respond(w, http.StatusOK, []Dataset{
+			{Name: "test-old", UploadedAt: mockDataset.UploadedAt.Add(-time.Hour)},
+			{Name: "test", UploadedAt: mockDataset.UploadedAt},
+			{Name: "truth", UploadedAt: mockDataset.UploadedAt.Add(time.Hour)},
+		})
+	})
 	r.HandleFunc("/hitec/repository/concepts/dataset/name/failed", func(w http.ResponseWriter, request *http.Request) {
 		respond(w, http.StatusBadRequest, nil)
 	})
@@ -127,6 +175,25 @@ func mockDetectionService(r *mux.Router) {
 	r.HandleFunc("/hitec/classify/concepts/fail2/run", func(w http.ResponseWriter, request *http.Request) {
 		respond(w, 0, nil)
 	})
+	r.HandleFunc("/hitec/spellchecker/run", func(w http.ResponseWriter, request *http.Request) {
+		var run Run
+		_ = json.NewDecoder(request.Body).Decode(&run)
+		if run.Params["persist"] == "false" || len(run.ProtectedTerms) > 0 {
+			var corrected []Document
+			for _, document := range run.Dataset.Documents {
+				if document.Id != "1" {
+					document.Text = strings.Replace(document.Text, "Text", "Test", 1)
+				}
+				corrected = append(corrected, document)
+			}
+			respond(w, http.StatusOK, map[string]interface{}{"message": "Spellchecking finished", "documents": corrected})
+			return
+		}
+		respond(w, http.StatusOK, map[string]string{"message": "Spellchecking finished"})
+	})
+	r.HandleFunc("/hitec/classify/relevance/run", func(w http.ResponseWriter, request *http.Request) {
+		respond(w, http.StatusOK, map[string]string{"message": "Relevance classification finished"})
+	})
 }
 
 func respond(writer http.ResponseWriter, statusCode int, body interface{}) {
@@ -400,3 +467,1288 @@ func TestRESTGetDataset(t *testing.T) {
 	_, err = RESTGetDataset("failed3")
 	assert.Error(t, err)
 }
+
+func TestGetMethods(t *testing.T) {
+	ep := endpoint{method: "GET", url: "/hitec/orchestration/concepts/methods/"}
+	rr := ep.mustExecuteRequest(nil)
+	assertSuccess(t, rr)
+
+	var methods []MethodConfig
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&methods))
+	var names []string
+	for _, method := range methods {
+		names = append(names, method.Name)
+	}
+	assert.Equal(t, []string{"acceptance-criteria", "frequency-rbai", "lda", "seanmf"}, names)
+	lda, _ := methodRegistry.Get("lda")
+	assert.Equal(t, "integer", lda.Params.Properties["n_topics"].Type)
+	assert.Equal(t, 4, lda.MaxConcurrent)
+
+	assert.Equal(t, baseURL+"/hitec/generate/acceptance-criteria/run", methodRegistry.Resolve("acceptance-criteria").RunURL())
+	assert.Equal(t, baseURL+"/hitec/classify/concepts/method/run", methodRegistry.Resolve("method").RunURL())
+}
+
+func TestPostStartNewDetectionParamValidation(t *testing.T) {
+	ep := endpoint{method: "POST", url: "/hitec/orchestration/concepts/detection/"}
+	minTopics := 1.0
+	methodRegistry.Register(MethodConfig{
+		Name: "validated",
+		Path: "/hitec/classify/concepts/method/run",
+		Params: ParamSchema{
+			Type: "object",
+			Properties: map[string]ParamProperty{
+				"n_topics": {Type: "integer", Minimum: &minTopics},
+				"alpha":    {Type: "number", Default: 0.1},
+				"mode":     {Type: "string", Enum: []interface{}{"fast", "exact"}},
+			},
+			Required: []string{"n_topics"},
+		},
+	})
+	defer methodRegistry.Unregister("validated")
+
+	var requestBody = make(map[string]interface{})
+	requestBody["dataset"] = "test"
+	requestBody["method"] = "validated"
+	requestBody["name"] = "test_"
+	requestBody["mode"] = "slow"
+	rr := ep.mustExecuteRequest(requestBody)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	var response ValidationErrorResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Equal(t, []ParamError{
+		{Field: "mode", Message: "must be one of fast, exact"},
+		{Field: "n_topics", Message: "parameter is required"},
+	}, response.Errors)
+
+	requestBody["mode"] = "fast"
+	requestBody["n_topics"] = "2.5"
+	assert.Equal(t, http.StatusBadRequest, ep.mustExecuteRequest(requestBody).Code)
+
+	requestBody["n_topics"] = 5
+	requestBody["n_topic"] = 5
+	rr = ep.mustExecuteRequest(requestBody)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `{"field":"n_topic","message":"unknown parameter"}`)
+
+	delete(requestBody, "n_topic")
+	assertSuccess(t, ep.mustExecuteRequest(requestBody))
+
+	params, paramErrors := analysisParams(detectionAnalysis, "validated", requestBody)
+	assert.Empty(t, paramErrors)
+	assert.Equal(t, map[string]string{"n_topics": "5", "alpha": "0.1", "mode": "fast"}, params)
+}
+
+func TestDetectionCallback(t *testing.T) {
+	webhookSecret = "secret"
+	received := make(chan WebhookPayload, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+		assert.Equal(t, signWebhookPayload(payload), r.Header.Get(headerWebhookSig))
+		var p WebhookPayload
+		_ = json.Unmarshal(payload, &p)
+		received <- p
+	}))
+	defer receiver.Close()
+
+	var requestBody = make(map[string]interface{})
+	requestBody["dataset"] = "test"
+	requestBody["method"] = "method"
+	requestBody["name"] = "test_"
+	requestBody[callbackURLKey] = "not a url"
+	ep := endpoint{method: "POST", url: "/hitec/orchestration/concepts/detection/"}
+	assert.Equal(t, http.StatusBadRequest, ep.mustExecuteRequest(requestBody).Code)
+
+	var result = new(Result)
+	result.Method = "method"
+	result.Name = "callback"
+	result.CallbackURL = receiver.URL
+	var run = new(Run)
+	run.Method = "method"
+	run.Dataset = mockDataset
+	_startNewDetection(result, run)
+
+	select {
+	case p := <-received:
+		assert.Equal(t, webhookEventFinished, p.Event)
+		assert.Equal(t, "callback", p.Result.Name)
+		assert.Equal(t, "finished", p.Result.Status)
+	case <-time.After(5 * time.Second):
+		t.Error("callback was not called")
+	}
+
+	run.Method = "fail"
+	result.Status = statusScheduled
+	_ = storeResult(result)
+	_startNewDetection(result, run)
+	select {
+	case p := <-received:
+		assert.Equal(t, webhookEventFailed, p.Event)
+	case <-time.After(5 * time.Second):
+		t.Error("callback was not called")
+	}
+
+	// without secret the payload is not signed
+	webhookSecret = ""
+	assert.Empty(t, signWebhookPayload([]byte("{}")))
+}
+
+func TestGetJobEvents(t *testing.T) {
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/hitec/orchestration/concepts/events/?job=events")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	var result = new(Result)
+	result.Method = "method"
+	result.Name = "events"
+	var run = new(Run)
+	run.Method = "method"
+	run.Dataset = mockDataset
+	go _startNewDetection(result, run)
+
+	var statuses []string
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() && len(statuses) < 2 {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var event JobEvent
+		assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event))
+		assert.Equal(t, "events", event.Job)
+		if event.Type == jobEventStatus {
+			statuses = append(statuses, event.Status)
+		}
+	}
+	assert.Equal(t, []string{"started", "finished"}, statuses)
+}
+
+func TestPipeline(t *testing.T) {
+	pipeline := Pipeline{
+		Name:    "pipeline",
+		Dataset: "test",
+		Params:  map[string]interface{}{"suffix": "checked"},
+		Steps: []PipelineStep{
+			{
+				ID:        "detect",
+				Kind:      stepKindDetection,
+				Method:    "method",
+				Dataset:   "{{steps.spell.dataset}}",
+				DependsOn: []string{"spell"},
+			},
+			{
+				ID:     "spell",
+				Kind:   stepKindSpellcheck,
+				Method: "spellchecker",
+				Params: map[string]interface{}{"new_dataset_name": "test"},
+			},
+		},
+	}
+
+	steps, paramErrors := resolvePipeline(pipeline)
+	assert.Empty(t, paramErrors)
+	assert.Equal(t, "spell", steps[0].ID)
+	assert.Equal(t, "detect", steps[1].ID)
+	assert.Equal(t, "test", steps[1].Dataset)
+	assert.Equal(t, "pipeline/detect", steps[1].Name)
+
+	parent := &Result{Name: "pipeline", Method: pipelineMethod}
+	_runPipeline(parent, steps)
+	assert.Equal(t, "finished", parent.Status)
+	assert.Equal(t, map[string]interface{}{"spell": "finished", "detect": "finished"}, parent.Metrics["steps"])
+
+	steps[0].Method = "fail"
+	steps[0].Kind = stepKindDetection
+	_runPipeline(parent, steps)
+	assert.Equal(t, "failed", parent.Status)
+	assert.Equal(t, map[string]interface{}{"spell": "failed", "detect": "skipped"}, parent.Metrics["steps"])
+	assert.Equal(t, statusCancelled, resultStates.status("pipeline/detect"))
+
+	pipeline.Steps[1].DependsOn = []string{"detect"}
+	_, paramErrors = resolvePipeline(pipeline)
+	assert.Equal(t, []ParamError{{Field: "steps", Message: "steps contain a cycle at step detect"}}, paramErrors)
+
+	pipeline.Steps[1].DependsOn = nil
+	pipeline.Steps[0].DependsOn = nil
+	_, paramErrors = resolvePipeline(pipeline)
+	assert.Equal(t, []ParamError{{Field: "steps.detect", Message: "unknown template variable steps.spell.dataset"}}, paramErrors)
+
+	ep := endpoint{method: "POST", url: "/hitec/orchestration/concepts/pipeline/"}
+	assert.Equal(t, http.StatusBadRequest, ep.mustExecuteRequest(pipeline).Code)
+
+	// relevance and spellcheck steps are validated like their requests
+	_, paramErrors = resolvePipeline(Pipeline{Name: "pipeline", Dataset: "test", Steps: []PipelineStep{
+		{ID: "relevance", Kind: stepKindRelevance, Method: "relevance", Params: map[string]interface{}{
+			"relevance_classification_conf": "Everything", "new_annotation_name": "annotation", "new_dataset_name": "relevant",
+		}},
+		{ID: "spell", Kind: stepKindSpellcheck, Method: "spellchecker"},
+	}})
+	assert.Equal(t, []ParamError{
+		{Field: "steps.relevance.params.relevance_classification_conf", Message: "must be one of OnlyDataset, OnlyAnnotation, AnnotationAndDataset"},
+		{Field: "steps.spell.params.new_dataset_name", Message: "parameter is required"},
+	}, paramErrors)
+}
+
+func TestSweep(t *testing.T) {
+	request := SweepRequest{
+		Name:    "sweep",
+		Method:  "method",
+		Dataset: "test",
+		Params:  map[string]interface{}{"alpha": 0.1},
+		Grid:    map[string][]interface{}{"n_topics": {5, 10}, "beta": {"a", "b"}},
+	}
+	combinations, paramErrors := sweepCombinations(request)
+	assert.Empty(t, paramErrors)
+	assert.Equal(t, []map[string]string{
+		{"alpha": "0.1", "beta": "a", "n_topics": "5"},
+		{"alpha": "0.1", "beta": "a", "n_topics": "10"},
+		{"alpha": "0.1", "beta": "b", "n_topics": "5"},
+		{"alpha": "0.1", "beta": "b", "n_topics": "10"},
+	}, combinations)
+
+	request.Random = map[string]SweepRange{"gamma": {Min: 1, Max: 3, Integer: true}}
+	request.Samples = 2
+	combinations, paramErrors = sweepCombinations(request)
+	assert.Empty(t, paramErrors)
+	assert.Len(t, combinations, 8)
+
+	request.Samples = 1 << 62
+	_, paramErrors = sweepCombinations(request)
+	assert.Equal(t, []ParamError{{Field: "samples", Message: "must be <= 100"}}, paramErrors)
+	request.Samples = 2
+
+	request.Random = nil
+	ep := endpoint{method: "POST", url: "/hitec/orchestration/concepts/sweep/"}
+	assertSuccess(t, ep.mustExecuteRequest(request))
+
+	var summary SweepSummary
+	for i := 0; i < 50 && summary.Status != "finished"; i++ {
+		time.Sleep(20 * time.Millisecond)
+		rr := endpoint{method: "GET", url: "/hitec/orchestration/concepts/sweep/sweep/"}.mustExecuteRequest(nil)
+		assertSuccess(t, rr)
+		_ = json.NewDecoder(rr.Body).Decode(&summary)
+	}
+	assert.Equal(t, "finished", summary.Status)
+	assert.Len(t, summary.Runs, 4)
+	assert.Len(t, summary.Groups["n_topics"], 2)
+	assert.Equal(t, 2, summary.Groups["n_topics"]["5"].Finished)
+
+	assert.Equal(t, http.StatusNotFound, endpoint{method: "GET", url: "/hitec/orchestration/concepts/sweep/unknown/"}.mustExecuteRequest(nil).Code)
+
+	request.Name = "sweep_missing"
+	request.Dataset = "missing"
+	rr := ep.mustExecuteRequest(request)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"dataset":"missing"`)
+}
+
+func TestEvaluateResult(t *testing.T) {
+	result := Result{Codes: []Code{{Name: "user interfaces"}, {Name: "Login"}, {Name: "accounts"}, {Name: "speed"}}}
+	evaluation := evaluateResult(result, mockTruthDataset)
+
+	assert.Equal(t, 1, evaluation.Overall[matchExact].Matched)
+	assert.Equal(t, 3, evaluation.Overall[matchLemma].Matched)
+	assert.InDelta(t, 0.75, evaluation.Overall[matchLemma].Precision, 0.001)
+	assert.InDelta(t, 1.0, evaluation.Overall[matchLemma].Recall, 0.001)
+	assert.InDelta(t, 0.857, evaluation.Overall[matchLemma].F1, 0.001)
+	assert.Equal(t, 1, evaluation.Documents["0"][matchLemma].Predicted)
+	assert.Equal(t, 1, evaluation.Documents["1"][matchExact].Matched)
+	assert.Equal(t, 2, evaluation.Documents["1"][matchLemma].Matched)
+
+	// topic words with weights are predicted like plain topic words
+	weighted := Result{Topics: map[string]interface{}{"0": []interface{}{[]interface{}{"login", 0.4}, "accounts"}}}
+	assert.Equal(t, []string{"accounts", "login"}, predictedConcepts(weighted))
+
+	assert.True(t, conceptsMatch("usr interface", "user interface", matchFuzzy))
+	assert.False(t, conceptsMatch("usr interface", "user interface", matchLemma))
+
+	ep := endpoint{method: "POST", url: "/hitec/orchestration/concepts/evaluation/"}
+	rr := ep.mustExecuteRequest(map[string]interface{}{"result": "evaluated"})
+	assertSuccess(t, rr)
+	var response Evaluation
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Equal(t, 2, response.Overall[matchLemma].Matched)
+	resultStates.mu.Lock()
+	assert.Equal(t, statusFinished, resultStates.states["evaluated"].status)
+	assert.NotNil(t, resultStates.states["evaluated"].result.Metrics[evaluationMetricKey])
+	resultStates.mu.Unlock()
+
+	// results that are still running are not evaluated
+	assert.Equal(t, http.StatusConflict, ep.mustExecuteRequest(map[string]interface{}{"result": "evaluated_running"}).Code)
+	assert.Equal(t, http.StatusBadRequest, ep.mustExecuteRequest(map[string]interface{}{}).Code)
+}
+
+func TestPostStartNewMultiDetection(t *testing.T) {
+	ep := endpoint{method: "POST", url: "/hitec/orchestration/concepts/multidetection/"}
+
+	var requestBody = make(map[string]interface{})
+	requestBody["dataset"] = "test#!#truth"
+	requestBody["method"] = "method"
+	requestBody["name"] = "multi"
+	rr := ep.mustExecuteRequest(requestBody)
+	assertSuccess(t, rr)
+	assertMessage(t, rr, "Detection started")
+
+	requestBody["dataset"] = "test#!#failed#!#failed3"
+	rr = ep.mustExecuteRequest(requestBody)
+	assert.Equal(t, http.StatusBadGateway, rr.Code)
+	var response DatasetErrorResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Len(t, response.Errors, 2)
+	assert.Equal(t, "failed", response.Errors[0].Dataset)
+	assert.Equal(t, "failed3", response.Errors[1].Dataset)
+
+	dataset, err := getDatasets("test#!#truth")
+	assert.NoError(t, err)
+	assert.Equal(t, "test#!#truth", dataset.Name)
+	assert.Equal(t, 5, dataset.Size)
+	assert.Equal(t, "Text 1", dataset.Documents[0].Text)
+}
+
+func TestCompareDatasetResults(t *testing.T) {
+	results := []Result{
+		{
+			DatasetName: "v1",
+			Codes:       []Code{{Name: "login"}, {Name: "crashes"}},
+			Topics:      map[string]interface{}{"0": []interface{}{"login", "password", "account"}},
+		},
+		{
+			DatasetName: "v2",
+			Codes:       []Code{{Name: "Login"}, {Name: "dark mode"}},
+			Topics: map[string]interface{}{
+				"0": []interface{}{"theme", "dark"},
+				"1": []interface{}{[]interface{}{"passwords", 0.4}, []interface{}{"login", 0.3}},
+			},
+		},
+	}
+	comparison := compareDatasetResults(results)
+	assert.Equal(t, []string{"v1", "v2"}, comparison.Datasets)
+	assert.Equal(t, []string{"login"}, comparison.SharedConcepts)
+	assert.Equal(t, map[string][]string{"v1": {"crashes"}, "v2": {"dark mode"}}, comparison.UniqueConcepts)
+	assert.Equal(t, TopicAlignment{Dataset: "v1", Topic: "0", OtherDataset: "v2", OtherTopic: "1", Similarity: 2.0 / 3.0}, comparison.Topics[0])
+
+	var requestBody = make(map[string]interface{})
+	requestBody["dataset"] = "test#!#truth"
+	requestBody["method"] = "method"
+	requestBody["name"] = "compare"
+	requestBody[datasetModeKey] = datasetModePerDataset
+	ep := endpoint{method: "POST", url: "/hitec/orchestration/concepts/multidetection/"}
+	assertSuccess(t, ep.mustExecuteRequest(requestBody))
+
+	parent := &Result{Name: "compare"}
+	datasets, _ := fetchDatasets([]string{"test", "truth"})
+	endResult := _startPerDatasetDetection(parent, Run{Method: "method", Params: map[string]string{}}, datasets)
+	assert.Equal(t, "finished", endResult.Status)
+	assert.Equal(t, []string{"test", "truth"}, endResult.Metrics[comparisonMetricKey].(DatasetComparison).Datasets)
+
+	requestBody[datasetModeKey] = "unknown"
+	assert.Equal(t, http.StatusBadRequest, ep.mustExecuteRequest(requestBody).Code)
+}
+
+func TestChunkedDetection(t *testing.T) {
+	index := 0
+	batchResults := []Result{
+		{
+			Codes:    []Code{{Name: "login", Tore: "Task", Index: &index}},
+			Topics:   map[string]interface{}{"0": []interface{}{"login"}},
+			DocTopic: map[string]interface{}{"0": []interface{}{0.9}},
+			Metrics:  map[string]interface{}{"coherence": 0.2, "model": "lda"},
+		},
+		{
+			Codes:    []Code{{Name: "Login", Tore: "Task", Index: &index}, {Name: "crash", Tore: "Domain Data", Index: &index}},
+			Topics:   map[string]interface{}{"0": []interface{}{"crash"}},
+			DocTopic: map[string]interface{}{"0": []interface{}{0.8}, "1": []interface{}{0.7}},
+			Metrics:  map[string]interface{}{"coherence": 0.5, "model": "lda"},
+		},
+	}
+	batches := []Run{
+		{Dataset: Dataset{Documents: make([]Document, 1)}},
+		{Dataset: Dataset{Documents: make([]Document, 2)}},
+	}
+	merged, err := mergeBatchResults(Result{Name: "chunked"}, batchResults, batches, []int{0, 1}, MergeStrategies{})
+	assert.NoError(t, err)
+	assert.Len(t, merged.Codes, 3)
+	assert.Equal(t, 2, *merged.Codes[2].Index)
+	assert.Len(t, merged.Topics, 2)
+	assert.InDelta(t, 0.4, merged.Metrics["coherence"], 1e-9)
+	assert.Equal(t, "lda", merged.Metrics["model"])
+	assert.Equal(t, 2.0, merged.Metrics["chunk_batches"])
+
+	merged, err = mergeBatchResults(Result{Name: "chunked"}, batchResults, batches, []int{0, 1},
+		MergeStrategies{Codes: mergeCodesDedupe, DocTopic: mergeDocTopicOffset, Metrics: mergeMetricsSum, Topics: mergeTopicsFirst})
+	assert.NoError(t, err)
+	assert.Len(t, merged.Codes, 2)
+	assert.Equal(t, map[string]interface{}{"0": []interface{}{"login"}}, merged.Topics)
+	assert.Len(t, merged.DocTopic, 3)
+	assert.InDelta(t, 0.7, merged.Metrics["coherence"], 1e-9)
+
+	token := 3
+	batchResults[1].Codes[1].Tokens = []*int{&token}
+	_, err = mergeBatchResults(Result{Name: "chunked"}, batchResults, batches, []int{0, 1}, MergeStrategies{})
+	assert.Contains(t, err.Error(), "batch 2 of 2 returned codes with token references")
+
+	run := Run{Method: "method", Dataset: mockDataset, ChunkSize: 1}
+	endResult, err := runDetection(Result{Name: "chunked"}, run)
+	assert.NoError(t, err)
+	assert.Equal(t, 3.0, endResult.Metrics["chunk_batches"])
+
+	run.Method = "fail"
+	_, err = runDetection(Result{Name: "chunked"}, run)
+	assert.Error(t, err)
+
+	assert.Error(t, ChunkingConfig{Merge: MergeStrategies{Codes: "unknown"}}.validate(""))
+	assert.Error(t, ChunkingConfig{BatchSize: 10}.validate(familyConceptExtraction))
+
+	var requestBody = make(map[string]interface{})
+	requestBody["dataset"] = "test"
+	requestBody["method"] = "method"
+	requestBody["name"] = "chunked"
+	requestBody[chunkSizeKey] = 0
+	ep := endpoint{method: "POST", url: "/hitec/orchestration/concepts/detection/"}
+	assert.Equal(t, http.StatusBadRequest, ep.mustExecuteRequest(requestBody).Code)
+	requestBody[chunkSizeKey] = 2
+	assertSuccess(t, ep.mustExecuteRequest(requestBody))
+}
+
+func TestResultCache(t *testing.T) {
+	resultCache = &ResultCache{entries: make(map[string]Result)}
+
+	run := &Run{Method: "method", Dataset: mockDataset, Params: map[string]string{"alpha": "0.3"}}
+	renamed := *run
+	renamed.Dataset.Name = "renamed"
+	assert.Equal(t, runHash(*run), runHash(renamed))
+	changed := *run
+	changed.Params = map[string]string{"alpha": "0.4"}
+	assert.NotEqual(t, runHash(*run), runHash(changed))
+
+	first := _startNewDetection(&Result{Name: "cache_1", Method: "method"}, run)
+	assert.Equal(t, "finished", first.Status)
+	assert.NotContains(t, first.Metrics, cachedFromMetricKey)
+
+	second := _startNewDetection(&Result{Name: "cache_2", Method: "method"}, run)
+	assert.Equal(t, "finished", second.Status)
+	assert.Equal(t, "cache_2", second.Name)
+	assert.Equal(t, "cache_1", second.Metrics[cachedFromMetricKey])
+
+	// the ground truth is not part of the hash, the evaluation must not be written into the cache
+	truthRun := *run
+	truthRun.Dataset.GroundTruth = mockTruthDataset.GroundTruth
+	evaluated := _startNewDetection(&Result{Name: "cache_truth", Method: "method"}, &truthRun)
+	assert.Contains(t, evaluated.Metrics, evaluationMetricKey)
+	entry, _ := resultCache.Lookup(runHash(*run))
+	assert.NotContains(t, entry.Metrics, evaluationMetricKey)
+	assert.NotContains(t, entry.Metrics, cachedFromMetricKey)
+
+	token := 0
+	resultCache.Add("copy", Result{Name: "copy", Topics: map[string]interface{}{"0": []interface{}{"login"}},
+		Metrics: map[string]interface{}{"coherence": 0.5}, Codes: []Code{{Name: "login", Tokens: []*int{&token}}}})
+	token = 5
+	entry, _ = resultCache.Lookup("copy")
+	clone := cloneCachedResult(Result{Name: "copy_2"}, entry)
+	clone.Topics["0"].([]interface{})[0] = "changed"
+	*clone.Codes[0].Tokens[0] = 9
+	clone.Metrics["coherence"] = 0.1
+	entry, _ = resultCache.Lookup("copy")
+	assert.Equal(t, []interface{}{"login"}, entry.Topics["0"])
+	assert.Equal(t, 0, *entry.Codes[0].Tokens[0])
+	assert.Equal(t, map[string]interface{}{"coherence": 0.5}, entry.Metrics)
+
+	run.Force = true
+	forced := _startNewDetection(&Result{Name: "cache_3", Method: "method"}, run)
+	assert.NotContains(t, forced.Metrics, cachedFromMetricKey)
+
+	run.Method = "fail"
+	run.Force = false
+	_startNewDetection(&Result{Name: "cache_4", Method: "fail"}, run)
+	_, cached := resultCache.Lookup(runHash(*run))
+	assert.False(t, cached)
+
+	force, paramErr := parseForce(map[string]interface{}{forceKey: "true"})
+	assert.True(t, force)
+	assert.Nil(t, paramErr)
+	_, paramErr = parseForce(map[string]interface{}{forceKey: 1})
+	assert.Equal(t, &ParamError{Field: forceKey, Message: "must be of type boolean"}, paramErr)
+
+	var requestBody = make(map[string]interface{})
+	requestBody["dataset"] = "test"
+	requestBody["method"] = "method"
+	requestBody["name"] = "cache_5"
+	requestBody[forceKey] = "sometimes"
+	ep := endpoint{method: "POST", url: "/hitec/orchestration/concepts/detection/"}
+	assert.Equal(t, http.StatusBadRequest, ep.mustExecuteRequest(requestBody).Code)
+	requestBody[forceKey] = true
+	assertSuccess(t, ep.mustExecuteRequest(requestBody))
+}
+
+func TestCron(t *testing.T) {
+	start := time.Date(2024, time.January, 1, 10, 7, 30, 0, time.UTC) // a monday
+
+	cron, err := parseCron("*/15 * * * *")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, time.January, 1, 10, 15, 0, 0, time.UTC), cron.Next(start))
+
+	cron, err = parseCron("30 6 * * 1-5")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, time.January, 2, 6, 30, 0, 0, time.UTC), cron.Next(start))
+
+	cron, err = parseCron("@weekly")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, time.January, 7, 0, 0, 0, 0, time.UTC), cron.Next(start))
+
+	cron, err = parseCron("0 0 13 * 5")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC), cron.Next(start))
+
+	cron, err = parseCron("0 0 30 2 *")
+	assert.NoError(t, err)
+	assert.True(t, cron.Next(start).IsZero())
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		_, err = parseCron(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestSchedules(t *testing.T) {
+	schedules = &ScheduleStore{schedules: make(map[string]*Schedule)}
+	ep := endpoint{method: "POST", url: "/hitec/orchestration/concepts/schedules/"}
+
+	var requestBody = make(map[string]interface{})
+	requestBody["name"] = "weekly"
+	requestBody["cron"] = "0 6 * * 1"
+	requestBody["method"] = "method"
+	requestBody["dataset"] = "test"
+	requestBody["latest_dataset"] = true
+	assertSuccess(t, ep.mustExecuteRequest(requestBody))
+
+	requestBody["cron"] = "0 6 * *"
+	assert.Equal(t, http.StatusBadRequest, ep.mustExecuteRequest(requestBody).Code)
+
+	list := schedules.List()
+	assert.Len(t, list, 1)
+	assert.Equal(t, time.Monday, list[0].NextRun.Weekday())
+
+	listed := endpoint{method: "GET", url: "/hitec/orchestration/concepts/schedules/"}.mustExecuteRequest(nil)
+	assert.Equal(t, http.StatusOK, listed.Code)
+	assert.Contains(t, listed.Body.String(), "weekly")
+
+	assert.Empty(t, schedules.Due(list[0].NextRun.Add(-time.Minute)))
+	due := schedules.Due(list[0].NextRun)
+	assert.Len(t, due, 1)
+	assert.True(t, schedules.List()[0].NextRun.After(list[0].NextRun))
+
+	at := time.Date(2024, time.January, 1, 6, 0, 0, 0, time.UTC)
+	endResult, err := runSchedule(due[0], at)
+	assert.NoError(t, err)
+	assert.Equal(t, "weekly-20240101-0600", endResult.Name)
+	assert.Equal(t, "test", endResult.DatasetName)
+	assert.Equal(t, "finished", endResult.Status)
+	assert.Equal(t, "weekly-20240101-0600", schedules.List()[0].LastResult)
+
+	due[0].Dataset = "missing"
+	_, err = runSchedule(due[0], at)
+	assert.Error(t, err)
+	assert.NotEmpty(t, schedules.List()[0].LastError)
+
+	deleteEp := endpoint{method: "DELETE", url: "/hitec/orchestration/concepts/schedules/weekly/"}
+	assertSuccess(t, deleteEp.mustExecuteRequest(nil))
+	assert.Equal(t, http.StatusNotFound, deleteEp.mustExecuteRequest(nil).Code)
+}
+
+func TestJSONFileStores(t *testing.T) {
+	dir := t.TempDir()
+	store := loadSchedules(dir + "/schedules.json")
+	store.Put(Schedule{Name: "weekly", Cron: "0 6 * * 1", Method: "lda"})
+	assert.Equal(t, "weekly", loadSchedules(dir + "/schedules.json").List()[0].Name)
+
+	glossaryStore := loadGlossaries(dir + "/glossaries.json")
+	glossaryStore.Put(Glossary{Name: "apps", Terms: []string{"WhatsApp"}})
+	assert.Equal(t, []string{"WhatsApp"}, loadGlossaries(dir + "/glossaries.json").List()[0].Terms)
+
+	files, _ := filepath.Glob(dir + "/*")
+	assert.Equal(t, []string{dir + "/glossaries.json", dir + "/schedules.json"}, files)
+}
+
+func TestJobJournal(t *testing.T) {
+	path := t.TempDir() + "/jobs.journal"
+	defer func() { jobJournal = &JobJournal{} }()
+	jobJournal = openJobJournal(path)
+
+	parent := Result{Name: "journal_sweep", Method: sweepMethod, Children: []string{"journal_sweep/run-1", "journal_sweep/run-2"}}
+	jobJournal.StartParent(parent)
+	jobJournal.StartDetection(Result{Name: "journal_sweep/run-1", Parent: parent.Name}, Run{Method: "method", Dataset: mockDataset})
+	jobJournal.End(Result{Name: "journal_sweep/run-1", Status: "finished"})
+	jobJournal.StartDetection(Result{Name: "journal_single"}, Run{Method: "method", Dataset: mockDataset, ChunkSize: 2})
+	jobJournal.StartDetection(Result{Name: "journal_missing"}, Run{Method: "method", Dataset: Dataset{Name: "missing"}})
+	jobJournal.StartDetection(Result{Name: "journal_done"}, Run{Method: "method", Dataset: mockDataset})
+	assert.NoError(t, storeResult(&Result{Name: "journal_done", Status: "started"}))
+	assert.NoError(t, storeResult(&Result{Name: "journal_done", Status: "finished"}))
+
+	pending, ended, err := readJobJournal(path)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 3)
+	assert.Equal(t, "journal_single", pending[1].Name)
+	assert.Equal(t, 2, pending[1].ChunkSize)
+	assert.True(t, ended["journal_sweep/run-1"])
+	assert.True(t, ended["journal_done"])
+
+	resumed, failed, unresolved := reconcileJobs(pending, ended, jobRecoveryResume)
+	assert.Empty(t, unresolved)
+	assert.Equal(t, []string{"journal_single"}, resumed)
+	assert.Equal(t, []string{"journal_missing", "journal_sweep", "journal_sweep/run-2"}, failed)
+	for _, name := range failed {
+		assert.Equal(t, statusFailed, resultStates.states[name].status)
+		assert.Equal(t, errorCategoryRestart, resultStates.states[name].result.Error.Category)
+	}
+
+	resumed, failed, _ = reconcileJobs(pending, ended, jobRecoveryFail)
+	assert.Empty(t, resumed)
+	assert.Len(t, failed, 4)
+
+	// jobs whose failed status cannot be stored stay in the journal until the next start
+	recoveryPath := t.TempDir() + "/recovery.journal"
+	jobJournal = openJobJournal(recoveryPath)
+	jobJournal.StartTask(Result{Name: "journal_orphan", Method: "spellchecker"})
+	storageURL := baseURL
+	baseURL = "http://127.0.0.1:1"
+	recoverJobs(recoveryPath)
+	baseURL = storageURL
+	pending, _, err = readJobJournal(recoveryPath)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "journal_orphan", pending[0].Name)
+
+	// the next start begins without the in-memory states of this one
+	resultStates.mu.Lock()
+	delete(resultStates.states, "journal_orphan")
+	resultStates.mu.Unlock()
+	recoverJobs(recoveryPath)
+	pending, ended, err = readJobJournal(recoveryPath)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+	assert.True(t, ended["journal_orphan"])
+
+	pending, _, err = readJobJournal(t.TempDir() + "/missing.journal")
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestMethodLimiter(t *testing.T) {
+	limiter := &MethodLimiter{queues: make(map[string]*methodQueue)}
+	waiting := func() int {
+		count := 0
+		for _, load := range limiter.Load() {
+			for _, n := range load.Waiting {
+				count += n
+			}
+		}
+		return count
+	}
+
+	release := limiter.Acquire("limited", "sweep-user", 1)
+	var mu sync.Mutex
+	var order []string
+	done := make(chan struct{}, 3)
+	for i, owner := range []string{"sweep-user", "sweep-user", "other-user"} {
+		go func(owner string) {
+			next := limiter.Acquire("limited", owner, 1)
+			mu.Lock()
+			order = append(order, owner)
+			mu.Unlock()
+			next()
+			done <- struct{}{}
+		}(owner)
+		for waiting() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	assert.Equal(t, 1, limiter.Load()[0].Running)
+	assert.Equal(t, map[string]int{"sweep-user": 2, "other-user": 1}, limiter.Load()[0].Waiting)
+
+	release()
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+	assert.Equal(t, []string{"sweep-user", "other-user", "sweep-user"}, order)
+	assert.Equal(t, 0, limiter.Load()[0].Running)
+
+	unlimited := limiter.Acquire("unlimited", "", 0)
+	unlimited()
+	assert.Len(t, limiter.Load(), 1)
+
+	rr := endpoint{method: "GET", url: "/hitec/orchestration/concepts/methods/load/"}.mustExecuteRequest(nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+type fakeRoundTripper struct {
+	status int
+	err    error
+	calls  int
+}
+
+func (f *fakeRoundTripper) RoundTrip(*http.Request) (*http.Response, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &http.Response{StatusCode: f.status, Body: io.NopCloser(strings.NewReader(""))}, nil
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+	breakers := newCircuitBreakers(2, time.Minute)
+	breakers.now = func() time.Time { return now }
+	downstream := &fakeRoundTripper{err: fmt.Errorf("connection refused")}
+	testClient := &http.Client{Transport: &circuitBreakerTransport{next: downstream, breakers: breakers}}
+
+	for i := 0; i < 2; i++ {
+		_, err := testClient.Get("http://storage:9684/dataset")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, circuitOpen, breakers.States()[0].State)
+
+	// open: fail fast without calling the service
+	_, err := testClient.Get("http://storage:9684/dataset")
+	assert.Contains(t, err.Error(), "circuit breaker open for storage:9684/dataset")
+	assert.Equal(t, 2, downstream.calls)
+
+	// other hosts are not affected
+	_, err = testClient.Get("http://detection:9700/run")
+	assert.Equal(t, 3, downstream.calls)
+
+	// half-open: a failed probe reopens the circuit
+	now = now.Add(time.Minute)
+	_, err = testClient.Get("http://storage:9684/dataset")
+	assert.Equal(t, 4, downstream.calls)
+	assert.Equal(t, circuitOpen, breakers.States()[1].State)
+
+	// a successful probe closes it
+	now = now.Add(time.Minute)
+	downstream.err = nil
+	downstream.status = http.StatusOK
+	_, err = testClient.Get("http://storage:9684/dataset")
+	assert.NoError(t, err)
+	assert.Equal(t, circuitClosed, breakers.States()[1].State)
+	assert.Equal(t, 0, breakers.States()[1].Failures)
+
+	// 503 responses count as failures
+	downstream.status = http.StatusServiceUnavailable
+	for i := 0; i < 2; i++ {
+		_, _ = testClient.Get("http://storage:9684/dataset")
+	}
+	assert.Equal(t, circuitOpen, breakers.States()[1].State)
+
+	// services behind the same host have their own circuit breakers
+	downstream.err = fmt.Errorf("connection refused")
+	for i := 0; i < 2; i++ {
+		_, _ = testClient.Get("http://orchestrator:9709/hitec/classify/concepts/lda/run")
+	}
+	_, err = testClient.Get("http://orchestrator:9709/hitec/classify/concepts/lda/run")
+	assert.Contains(t, err.Error(), "circuit breaker open for lda")
+	calls := downstream.calls
+	_, err = testClient.Get("http://orchestrator:9709/hitec/classify/concepts/fail/run")
+	assert.NotContains(t, err.Error(), "circuit breaker open")
+	_, err = testClient.Get("http://orchestrator:9709/hitec/repository/concepts/dataset/name/test")
+	assert.NotContains(t, err.Error(), "circuit breaker open")
+	assert.Equal(t, calls+2, downstream.calls)
+	assert.Equal(t, "orchestrator:9709/hitec/classify/concepts/fail", circuitService(&url.URL{Host: "orchestrator:9709", Path: "/hitec/classify/concepts/fail/run"}))
+	assert.Equal(t, "orchestrator:9709/hitec/repository/concepts", circuitService(&url.URL{Host: "orchestrator:9709", Path: "/hitec/repository/concepts/dataset/name/test"}))
+
+	rr := endpoint{method: "GET", url: "/hitec/orchestration/concepts/status/"}.mustExecuteRequest(nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "circuit_breakers")
+}
+
+func TestResultLifecycle(t *testing.T) {
+	result := &Result{Name: "lifecycle_1", Status: statusFinished}
+	err := storeResult(result)
+	assert.True(t, isInvalidTransition(err))
+	// jobs of a previous process are failed when the journal is reconciled
+	assert.NoError(t, storeResult(&Result{Name: "lifecycle_restart", Status: statusFailed}))
+
+	result.Status = statusStarted
+	result.StartedAt = time.Now().Add(-time.Second)
+	assert.NoError(t, storeResult(result))
+	assert.Equal(t, 1, result.Attempts)
+	assert.Nil(t, result.FinishedAt)
+	result.Status = statusFinished
+	assert.NoError(t, storeResult(result))
+	assert.NotNil(t, result.FinishedAt)
+	assert.True(t, result.DurationSeconds >= 1)
+
+	// a finished result may only be started again after it is scheduled
+	result.Status = statusStarted
+	assert.True(t, isInvalidTransition(storeResult(result)))
+	result.Status = statusScheduled
+	assert.NoError(t, storeResult(result))
+	result.Status = statusStarted
+	assert.NoError(t, storeResult(result))
+	assert.Equal(t, 2, result.Attempts)
+	assert.Nil(t, result.FinishedAt)
+
+	cancelEp := endpoint{method: "POST", url: "/hitec/orchestration/concepts/results/lifecycle_1/cancel/"}
+	assertSuccess(t, cancelEp.mustExecuteRequest(nil))
+	assert.Equal(t, http.StatusConflict, cancelEp.mustExecuteRequest(nil).Code)
+	unknownEp := endpoint{method: "POST", url: "/hitec/orchestration/concepts/results/lifecycle_unknown/cancel/"}
+	assert.Equal(t, http.StatusConflict, unknownEp.mustExecuteRequest(nil).Code)
+
+	// the response of a cancelled detection is discarded
+	result.Status = statusFinished
+	assert.True(t, isInvalidTransition(storeResult(result)))
+
+	// a result cancelled while it is scheduled is not started
+	queued := &Result{Name: "lifecycle_queued", Method: "fail", Status: statusScheduled}
+	assert.NoError(t, storeResult(queued))
+	assertSuccess(t, endpoint{method: "POST", url: "/hitec/orchestration/concepts/results/lifecycle_queued/cancel/"}.mustExecuteRequest(nil))
+	run := &Run{Method: "fail", Dataset: mockDataset, Force: true}
+	endResult := _startNewDetection(queued, run)
+	assert.Equal(t, statusCancelled, endResult.Status)
+	assert.Equal(t, 0, endResult.Attempts)
+
+	endResult = _startNewDetection(&Result{Name: "lifecycle_2", Method: "fail"}, run)
+	assert.Equal(t, statusFailed, endResult.Status)
+	assert.Equal(t, errorCategoryMethod, endResult.Error.Category)
+	assert.Equal(t, http.StatusNotFound, endResult.Error.HTTPStatus)
+	assert.Equal(t, 1, endResult.Attempts)
+	assert.NotNil(t, endResult.FinishedAt)
+
+	assert.Equal(t, errorCategoryUnavailable, newResultError(&CircuitOpenError{Service: "storage"}, errorCategoryDataset).Category)
+
+	// statuses the storage did not accept are not published
+	events, _ := jobEvents.Subscribe("lifecycle_unstored")
+	defer jobEvents.Unsubscribe(events)
+	storageURL := baseURL
+	baseURL = "http://127.0.0.1:1"
+	assert.Error(t, storeResult(&Result{Name: "lifecycle_unstored", Status: statusScheduled}))
+	baseURL = storageURL
+	assert.Equal(t, 0, len(events))
+
+	// a final status the storage did not accept fails the result
+	failingStorage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failingStorage.Close()
+	unstored := &Result{Name: "lifecycle_task_unstored", Method: "task", Status: statusScheduled}
+	assert.NoError(t, storeResult(unstored))
+	taskResult := _startTask(unstored, func() (map[string]interface{}, error) {
+		baseURL = failingStorage.URL
+		return map[string]interface{}{}, nil
+	})
+	baseURL = storageURL
+	assert.Equal(t, statusFailed, taskResult.Status)
+	assert.Equal(t, errorCategoryStorage, taskResult.Error.Category)
+}
+
+func TestEnsemble(t *testing.T) {
+	request := EnsembleRequest{
+		Name:    "ensemble",
+		Dataset: "test",
+		Members: []EnsembleMember{{Method: "a", Weight: 2}, {Method: "b"}, {Method: "c"}},
+	}
+	_, paramErrors := validateEnsemble(&request)
+	assert.Empty(t, paramErrors)
+	assert.Equal(t, ensembleVote, request.Strategy)
+	assert.Equal(t, 2, request.MinVotes)
+	assert.Equal(t, 1.0, request.Members[1].Weight)
+
+	results := []Result{
+		{Name: "ensemble/member-1", Codes: []Code{{Name: "user interfaces", Tore: "Interaction"}, {Name: "login", Tore: "Function"}}},
+		{Name: "ensemble/member-2", Codes: []Code{{Name: "User interface", Tore: "Interaction"}, {Name: "speed", Tore: "Quality"}}},
+		{Name: "ensemble/member-3", Codes: []Code{{Name: "speed", Tore: "Quality"}, {Name: "login", Tore: "Data"}}},
+	}
+	codes, concepts := mergeEnsembleCodes(results, request)
+	assert.Len(t, codes, 2)
+	assert.Equal(t, "user interfaces", codes[0].Name)
+	assert.Equal(t, 0, *codes[0].Index)
+	assert.Equal(t, []string{"ensemble/member-1", "ensemble/member-2"}, concepts[0].Members)
+	assert.Equal(t, 0.75, concepts[0].Score)
+	assert.Equal(t, "speed", codes[1].Name)
+
+	request.Strategy = ensembleWeightedUnion
+	request.MinWeight = 0.5
+	codes, _ = mergeEnsembleCodes(results, request)
+	assert.Len(t, codes, 3)
+	request.MinWeight = 0
+	codes, _ = mergeEnsembleCodes(results, request)
+	assert.Len(t, codes, 4)
+
+	invalid := EnsembleRequest{Name: "ensemble", Dataset: "test", Strategy: "median", Members: []EnsembleMember{{Method: "method"}}}
+	rr := endpoint{method: "POST", url: "/hitec/orchestration/concepts/ensemble/"}.mustExecuteRequest(invalid)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "strategy")
+	assert.Contains(t, rr.Body.String(), "members")
+
+	valid := EnsembleRequest{Name: "ensemble_ok", Dataset: "test", Members: []EnsembleMember{{Method: "method"}, {Method: "method"}}}
+	assertSuccess(t, endpoint{method: "POST", url: "/hitec/orchestration/concepts/ensemble/"}.mustExecuteRequest(valid))
+
+	parent := &Result{Name: "ensemble_failed", Method: ensembleMethod}
+	members := []*Result{{Name: "ensemble_failed/member-1", Method: "method"}, {Name: "ensemble_failed/member-2", Method: "fail"}}
+	failing := EnsembleRequest{Members: []EnsembleMember{{Method: "method", Weight: 1}, {Method: "fail", Weight: 1}}, Strategy: ensembleVote, MinVotes: 2}
+	_runEnsemble(parent, members, failing, mockDataset)
+	assert.Equal(t, statusFailed, parent.Status)
+	assert.Equal(t, errorCategoryDependency, parent.Error.Category)
+	assert.Contains(t, parent.Error.Message, "ensemble_failed/member-2")
+}
+
+func TestDryRun(t *testing.T) {
+	ep := endpoint{method: "POST", url: "/hitec/orchestration/concepts/detection/"}
+	body := map[string]interface{}{"dataset": "test", "method": "method", "name": "dry_run", "alpha": 0.2, "chunk_size": 2, "dry_run": true}
+	rr := ep.mustExecuteRequest(body)
+	assertSuccess(t, rr)
+	var response DryRunResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Len(t, response.Requests, 2)
+	assert.Equal(t, baseURL+"/hitec/classify/concepts/method/run", response.Requests[0].URL)
+	assert.Contains(t, string(response.Requests[0].Payload), `"alpha":"0.2"`)
+	assert.NotContains(t, string(response.Requests[0].Payload), dryRunKey)
+	_, active := resultStates.active("dry_run")
+	assert.False(t, active)
+
+	body["dry_run"] = "maybe"
+	assert.Equal(t, http.StatusBadRequest, ep.mustExecuteRequest(body).Code)
+
+	ep = endpoint{method: "POST", url: "/hitec/orchestration/concepts/spellchecker/"}
+	rr = ep.mustExecuteRequest(map[string]interface{}{
+		"run_name": "dry_spell", "method": "spellchecker", "original_dataset_name": "test", "new_dataset_name": "spelled", "dry_run": true,
+	})
+	assertSuccess(t, rr)
+	response = DryRunResponse{}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Len(t, response.Requests, 1)
+	assert.Equal(t, baseURL+"/hitec/spellchecker/run", response.Requests[0].URL)
+	assert.Contains(t, string(response.Requests[0].Payload), `"new_dataset_name":"spelled"`)
+}
+
+func TestResultDiff(t *testing.T) {
+	rr := endpoint{method: "GET", url: "/hitec/orchestration/concepts/results/diff/?base=diff_base&other=diff_other"}.mustExecuteRequest(nil)
+	assertSuccess(t, rr)
+	var diff ResultDiff
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&diff))
+	assert.Equal(t, []string{"user interfaces"}, diff.SharedConcepts)
+	assert.Equal(t, []string{"login"}, diff.RemovedConcepts)
+	assert.Equal(t, []string{"crash"}, diff.AddedConcepts)
+	assert.InDelta(t, 1.0/3, diff.ConceptSimilarity, 1e-9)
+	assert.Equal(t, "a", diff.Topics[0].OtherTopic)
+	assert.InDelta(t, 1.0/3, diff.Topics[0].Similarity, 1e-9)
+	assert.InDelta(t, 0.25, diff.Metrics["coherence"].Delta, 1e-9)
+	assert.Equal(t, []string{"perplexity"}, diff.OnlyBaseMetrics)
+	assert.Equal(t, ParamChange{Base: "0.1", Other: "0.2"}, diff.ParamChanges["alpha"])
+
+	rr = endpoint{method: "GET", url: "/hitec/orchestration/concepts/results/diff/?base=diff_base&other=unknown"}.mustExecuteRequest(nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = endpoint{method: "GET", url: "/hitec/orchestration/concepts/results/diff/?base=diff_base"}.mustExecuteRequest(nil)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// the slash in the names of child results is escaped
+	child, err := RESTGetResult("sweep/run-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "/hitec/repository/concepts/detection/result/name/sweep%2Frun-1", child.Name)
+}
+
+func TestValidateMethodResponse(t *testing.T) {
+	topicModel := MethodConfig{Name: "lda", Family: familyTopicModel}
+	assert.NoError(t, validateMethodResponse(topicModel, []byte(`{"topics": {"0": ["login", "account"]}, "doc_topic": {"0": [0.9, 0.1]}, "metrics": {"coherence": 0.4}}`)))
+	err := validateMethodResponse(topicModel, []byte(`{"topics": {"0": []}, "doc_topic": {"0": [-0.1]}, "metrics": {"per_topic": [1, 2]}}`))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "topics.0 has no word")
+	assert.Contains(t, err.Error(), "doc_topic.0[0] is negative")
+	assert.Contains(t, err.Error(), "metrics.per_topic")
+	err = validateMethodResponse(topicModel, []byte(`{"topics": {"0": "login"}}`))
+	assert.Contains(t, err.Error(), "cannot unmarshal")
+	// topic words may carry their weight
+	assert.NoError(t, validateMethodResponse(topicModel, []byte(`{"topics": {"0": [["login", 0.3], "account"]}}`)))
+	err = validateMethodResponse(topicModel, []byte(`{"topics": {"0": [["login"], [0.3, "login"], " ", 1]}}`))
+	for i := 0; i < 4; i++ {
+		assert.Contains(t, err.Error(), fmt.Sprintf("topics.0[%d] is not a word or a [word, weight] pair", i))
+	}
+	for _, name := range []string{"lda", "seanmf"} {
+		method, _ := methodRegistry.Get(name)
+		assert.Equal(t, familyTopicModel, method.Family)
+	}
+	method, _ := methodRegistry.Get("frequency-rbai")
+	assert.Equal(t, familyConceptExtraction, method.Family)
+
+	concepts := MethodConfig{Name: "tore", Family: familyConceptExtraction}
+	assert.NoError(t, validateMethodResponse(concepts, []byte(`{"codes": [{"name": "login", "tokens": [0, 1]}]}`)))
+	err = validateMethodResponse(concepts, []byte(`{"codes": [{"name": " ", "tokens": [null]}]}`))
+	assert.Contains(t, err.Error(), "codes[0].name is empty")
+	assert.Contains(t, err.Error(), "codes[0].tokens[0]")
+	assert.Contains(t, validateMethodResponse(concepts, []byte(`{}`)).Error(), "codes is missing")
+
+	classification := MethodConfig{Name: "relevance", Family: familyClassification}
+	assert.NoError(t, validateMethodResponse(classification, []byte(`{"doc_topic": {"0": "relevant"}}`)))
+	assert.Error(t, validateMethodResponse(classification, []byte(`{"doc_topic": {"0": ""}}`)))
+	assert.NoError(t, validateMethodResponse(MethodConfig{Name: "method"}, []byte(`{"topics": "anything"}`)))
+
+	methodRegistry.Register(MethodConfig{Name: "typed", Path: "/hitec/classify/concepts/method/run", Family: familyAcceptanceCriteria})
+	defer methodRegistry.Unregister("typed")
+	endResult := _startNewDetection(&Result{Name: "typed_1", Method: "typed"}, &Run{Method: "typed", Dataset: mockDataset, Force: true})
+	assert.Equal(t, statusFailed, endResult.Status)
+	assert.Equal(t, errorCategoryResponse, endResult.Error.Category)
+	assert.Contains(t, endResult.Error.Message, "topics is empty")
+}
+
+func TestAsyncTasks(t *testing.T) {
+	ep := endpoint{method: "POST", url: "/hitec/orchestration/concepts/spellchecker/"}
+	rr := ep.mustExecuteRequest(map[string]interface{}{
+		"run_name": "async_spell", "method": "spellchecker", "original_dataset_name": "test", "new_dataset_name": "spelled",
+	})
+	assertSuccess(t, rr)
+	var started RunStartedResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&started))
+	assert.Equal(t, "async_spell", started.Result.Name)
+	assert.Equal(t, statusScheduled, started.Result.Status)
+
+	run := Run{Method: "spellchecker", Dataset: mockDataset}
+	endResult := _startTask(&Result{Name: "async_spell_2", Method: "spellchecker"}, func() (map[string]interface{}, error) {
+		return RESTPostStartSpellchecking(run)
+	})
+	assert.Equal(t, statusFinished, endResult.Status)
+	assert.Equal(t, map[string]interface{}{"message": "Spellchecking finished"}, endResult.Metrics[taskResponseMetricKey])
+
+	endResult = _startTask(&Result{Name: "async_relevance", Method: "relevance"}, func() (map[string]interface{}, error) {
+		return nil, &DownstreamError{URL: "relevance", StatusCode: http.StatusBadGateway}
+	})
+	assert.Equal(t, statusFailed, endResult.Status)
+	assert.Equal(t, http.StatusBadGateway, endResult.Error.HTTPStatus)
+
+	_, failed, _ := reconcileJobs([]JournalEntry{{Event: journalStarted, Kind: jobKindTask, Name: "async_interrupted"}}, nil, jobRecoveryResume)
+	assert.Equal(t, []string{"async_interrupted"}, failed)
+	_, active := resultStates.active("async_interrupted")
+	assert.False(t, active)
+	assert.Equal(t, statusFailed, resultStates.states["async_interrupted"].status)
+}
+
+func TestStartAnalysis(t *testing.T) {
+	rr := endpoint{method: "POST", url: "/hitec/orchestration/concepts/relevance/"}.mustExecuteRequest(map[string]interface{}{
+		"method": "relevance", "original_dataset_name": "test", "relevance_classification_conf": "OnlyDataset", "callback_url": "ftp://x",
+	})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	var validation ValidationErrorResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&validation))
+	var fields []string
+	for _, paramError := range validation.Errors {
+		fields = append(fields, paramError.Field)
+	}
+	assert.Equal(t, []string{callbackURLKey, "new_annotation_name", "new_dataset_name"}, fields)
+
+	rr = endpoint{method: "POST", url: "/hitec/orchestration/concepts/relevance/"}.mustExecuteRequest(map[string]interface{}{
+		"method": "relevance", "original_dataset_name": 3, "relevance_classification_conf": "Everything",
+		"new_annotation_name": []string{"annotation"}, "new_dataset_name": "",
+	})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	validation = ValidationErrorResponse{}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&validation))
+	assert.Equal(t, []ParamError{
+		{Field: "original_dataset_name", Message: "must be of type string"},
+		{Field: "new_annotation_name", Message: "must be of type string"},
+		{Field: "new_dataset_name", Message: "parameter is required"},
+		{Field: "relevance_classification_conf", Message: "must be one of OnlyDataset, OnlyAnnotation, AnnotationAndDataset"},
+	}, validation.Errors)
+
+	request, paramErrors := decodeRelevanceRequest(map[string]interface{}{
+		"relevance_classification_conf": "OnlyDataset", "new_annotation_name": 1, "new_dataset_name": "relevant",
+	})
+	assert.Equal(t, RelevanceClassificationRequest{Conf: "OnlyDataset", NewDatasetName: "relevant"}, request)
+	assert.Equal(t, []ParamError{{Field: "new_annotation_name", Message: "must be of type string"}}, paramErrors)
+
+	rr = endpoint{method: "POST", url: "/hitec/orchestration/concepts/relevance/"}.mustExecuteRequest(map[string]interface{}{
+		"method": "relevance", "original_dataset_name": "test", "relevance_classification_conf": "OnlyAnnotation",
+		"new_annotation_name": "annotation", "new_dataset_name": "relevant",
+	})
+	assertSuccess(t, rr)
+	var relevanceStarted RunStartedResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&relevanceStarted))
+	assert.Equal(t, "AnnotationName:annotation", relevanceStarted.Result.Name)
+
+	rr = endpoint{method: "POST", url: "/hitec/orchestration/concepts/relevance/"}.mustExecuteRequest(map[string]interface{}{
+		"method": "relevance", "original_dataset_name": "test", "relevance_classification_conf": "OnlyDataset",
+		"new_annotation_name": "annotation", "new_dataset_name": "relevant", "persist": true, "dry_run": true,
+	})
+	assertSuccess(t, rr)
+	assert.NotContains(t, rr.Body.String(), "persist")
+	assert.NotContains(t, rr.Body.String(), "original_dataset_name")
+
+	rr = endpoint{method: "POST", url: "/hitec/orchestration/concepts/spellchecker/"}.mustExecuteRequest(map[string]interface{}{
+		"method": "spellchecker", "original_dataset_name": "test", "new_dataset_name": "spelled",
+	})
+	assertSuccess(t, rr)
+	var started RunStartedResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&started))
+	assert.Equal(t, "Spellchecked:spelled", started.Result.Name)
+	assert.Equal(t, "Spellchecking started", started.Message)
+
+	// single detections do not combine datasets
+	rr = endpoint{method: "POST", url: "/hitec/orchestration/concepts/detection/"}.mustExecuteRequest(map[string]interface{}{
+		"method": "method", "dataset": "test#!#truth", "name": "single", "dry_run": true,
+	})
+	assertSuccess(t, rr)
+	var dryRun DryRunResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&dryRun))
+	assert.Len(t, dryRun.Requests, 1)
+	assert.NotContains(t, string(dryRun.Requests[0].Payload), mockTruthDataset.Documents[0].Text)
+
+	rr = endpoint{method: "POST", url: "/hitec/orchestration/concepts/detection/"}.mustExecuteRequest(map[string]interface{}{"dataset": "test", "method": "method"})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"field":"name"`)
+	rr = endpoint{method: "POST", url: "/hitec/orchestration/concepts/detection/"}.mustExecuteRequest(map[string]interface{}{"dataset": "test", "method": "method", "name": 5})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"field":"name","message":"must be of type string"`)
+	assert.NotContains(t, rr.Body.String(), "parameter is required")
+
+	// unknown datasets are not found, failures of the storage are bad gateways
+	rr = endpoint{method: "POST", url: "/hitec/orchestration/concepts/detection/"}.mustExecuteRequest(map[string]interface{}{"dataset": "missing", "method": "method", "name": "missing"})
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = endpoint{method: "POST", url: "/hitec/orchestration/concepts/detection/"}.mustExecuteRequest(map[string]interface{}{"dataset": "failed", "method": "method", "name": "missing"})
+	assert.Equal(t, http.StatusBadGateway, rr.Code)
+
+	// a result that is still running is not scheduled again
+	resultStates.load(Result{Name: "single_running", Status: statusStarted})
+	rr = endpoint{method: "POST", url: "/hitec/orchestration/concepts/detection/"}.mustExecuteRequest(map[string]interface{}{"dataset": "test", "method": "method", "name": "single_running"})
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"status":false`)
+}
+
+func TestSpellcheckPreview(t *testing.T) {
+	changes, marked := diffTokens(strings.Fields("the app crashs when i login"), strings.Fields("the app crashes when I log in"))
+	assert.Equal(t, []TokenChange{
+		{Type: changeReplace, Position: 2, Original: "crashs", Corrected: "crashes"},
+		{Type: changeReplace, Position: 4, Original: "i login", Corrected: "I log in"},
+	}, changes)
+	assert.Equal(t, "the app [-crashs-]{+crashes+} when [-i login-]{+I log in+}", marked)
+	changes, marked = diffTokens(strings.Fields("very very slow"), strings.Fields("very slow !"))
+	assert.Equal(t, []TokenChange{
+		{Type: changeDelete, Position: 1, Original: "very"},
+		{Type: changeInsert, Position: 3, Corrected: "!"},
+	}, changes)
+	assert.Equal(t, "very [-very-] slow {+!+}", marked)
+
+	rr := endpoint{method: "POST", url: "/hitec/orchestration/concepts/spellchecker/"}.mustExecuteRequest(map[string]interface{}{
+		"method": "spellchecker", "original_dataset_name": "test", "new_dataset_name": "spelled", "preview": "yes",
+	})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"field":"preview"`)
+
+	run := Run{Method: "spellchecker", Dataset: mockDataset, Params: map[string]string{"new_dataset_name": "spelled"}, Preview: true}
+	endResult := _startTask(&Result{Name: "preview_spell", Method: "spellchecker"}, func() (map[string]interface{}, error) {
+		return runSpellcheckPreview("preview_spell", run)
+	})
+	assert.Equal(t, statusFinished, endResult.Status)
+	assert.Equal(t, 2, endResult.Metrics[taskResponseMetricKey].(map[string]interface{})["changed_documents"])
+	assert.Empty(t, run.Params["persist"])
+
+	rr = endpoint{method: "GET", url: "/hitec/orchestration/concepts/spellchecker/preview/preview_spell/"}.mustExecuteRequest(nil)
+	assertSuccess(t, rr)
+	var preview SpellcheckPreview
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&preview))
+	assert.Equal(t, previewPending, preview.Status)
+	assert.Equal(t, "spelled", preview.NewDatasetName)
+	assert.Len(t, preview.Documents, 3)
+	assert.Equal(t, "[-Text-]{+Test+} 1", preview.Documents[0].Marked)
+	assert.False(t, preview.Documents[1].Changed)
+
+	ep := endpoint{method: "POST", url: "/hitec/orchestration/concepts/spellchecker/preview/preview_spell/accept/"}
+	rr = ep.mustExecuteRequest(map[string]interface{}{"documents": []string{"2", "7"}})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"field":"documents[1]"`)
+	rr = ep.mustExecuteRequest(map[string]interface{}{"documents": []string{"2"}})
+	assertSuccess(t, rr)
+	assert.Contains(t, rr.Body.String(), "with 1 corrected documents")
+	// accepted previews are removed
+	rr = ep.mustExecuteRequest(nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = endpoint{method: "GET", url: "/hitec/orchestration/concepts/spellchecker/preview/missing/"}.mustExecuteRequest(nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// previews expire
+	spellcheckPreviews.Put(&SpellcheckPreview{Name: "preview_expired", CreatedAt: time.Now().Add(-previewRetention - time.Minute)})
+	_, ok := spellcheckPreviews.Get("preview_expired")
+	assert.False(t, ok)
+
+	// a spellchecker that ignores persist=false fails the preview
+	ignoringSpellchecker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		respond(w, http.StatusOK, map[string]string{"message": "Spellchecking finished"})
+	}))
+	defer ignoringSpellchecker.Close()
+	storageURL := baseURL
+	baseURL = ignoringSpellchecker.URL
+	endResult = _startTask(&Result{Name: "preview_ignored", Method: "spellchecker"}, func() (map[string]interface{}, error) {
+		return runSpellcheckPreview("preview_ignored", Run{Method: "spellchecker", Dataset: mockDataset, Preview: true})
+	})
+	baseURL = storageURL
+	assert.Equal(t, statusFailed, endResult.Status)
+	assert.Equal(t, errorCategoryResponse, endResult.Error.Category)
+	_, ok = spellcheckPreviews.Get("preview_ignored")
+	assert.False(t, ok)
+
+	// large documents are compared after skipping the unchanged prefix and suffix, or replaced as a whole
+	long := strings.Fields(strings.Repeat("word ", 2000))
+	corrected := append(append([]string{}, long[:1000]...), append([]string{"fixed"}, long[1001:]...)...)
+	changes, _ = diffTokens(long, corrected)
+	assert.Equal(t, []TokenChange{{Type: changeReplace, Position: 1000, Original: "word", Corrected: "fixed"}}, changes)
+	changes, _ = diffTokens(append([]string{"a"}, long...), append(long, "b"))
+	assert.Len(t, changes, 1)
+}
+
+func TestGlossary(t *testing.T) {
+	changes, _ := diffTokens(strings.Fields("I use Google Maps daily."), strings.Fields("I use Google Map daily."))
+	assert.Equal(t, []string{"google maps"}, markGlossaryChanges(strings.Fields("I use Google Maps daily."), changes, []string{"daily", "google maps"}))
+	assert.True(t, changes[0].Glossary)
+
+	ep := endpoint{method: "POST", url: "/hitec/orchestration/concepts/glossaries/"}
+	rr := ep.mustExecuteRequest(map[string]interface{}{"terms": []string{"Text", " "}})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"field":"name"`)
+	assert.Contains(t, rr.Body.String(), `"field":"terms[1]"`)
+
+	rr = ep.mustExecuteRequest(map[string]interface{}{"name": "apps", "terms": []string{"Text", " text ", "Google  Maps"}})
+	assertSuccess(t, rr)
+	var glossary Glossary
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&glossary))
+	assert.Equal(t, []string{"Google Maps", "Text"}, glossary.Terms)
+
+	rr = endpoint{method: "GET", url: "/hitec/orchestration/concepts/glossaries/"}.mustExecuteRequest(nil)
+	assertSuccess(t, rr)
+	assert.Contains(t, rr.Body.String(), `"name":"apps"`)
+
+	spellcheck := endpoint{method: "POST", url: "/hitec/orchestration/concepts/spellchecker/"}
+	rr = spellcheck.mustExecuteRequest(map[string]interface{}{
+		"method": "spellchecker", "original_dataset_name": "test", "new_dataset_name": "spelled", "glossary": "missing",
+	})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"field":"glossary"`)
+	rr = spellcheck.mustExecuteRequest(map[string]interface{}{
+		"method": "spellchecker", "original_dataset_name": "test", "new_dataset_name": "spelled", "flag_glossary": true,
+	})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"field":"flag_glossary"`)
+	rr = spellcheck.mustExecuteRequest(map[string]interface{}{
+		"method": "spellchecker", "original_dataset_name": "test", "new_dataset_name": "spelled", "glossary": "apps", "dry_run": true,
+	})
+	assertSuccess(t, rr)
+	assert.Contains(t, rr.Body.String(), `"protected_terms":["Google Maps","Text"]`)
+	assert.NotContains(t, rr.Body.String(), `"glossary"`)
+
+	run := Run{Method: "spellchecker", Dataset: mockDataset, ProtectedTerms: glossary.Terms, FlagGlossary: true}
+	message, err := RESTPostStartSpellchecking(run)
+	assert.NoError(t, err)
+	flagged := flagGlossaryCorrections(run, message)[glossaryCorrectionsKey].([]GlossaryCorrection)
+	assert.Len(t, flagged, 2)
+	assert.Equal(t, GlossaryCorrection{Id: "0", Terms: []string{"Text"}, Marked: "[-Text-]{+Test+} 1"}, flagged[0])
+
+	run.Preview = true
+	_, err = runSpellcheckPreview("glossary_preview", run)
+	assert.NoError(t, err)
+	preview, _ := spellcheckPreviews.Get("glossary_preview")
+	assert.Equal(t, []string{"Text"}, preview.Documents[2].GlossaryTerms)
+	assert.Empty(t, preview.Documents[1].GlossaryTerms)
+
+	del := endpoint{method: "DELETE", url: "/hitec/orchestration/concepts/glossaries/apps/"}
+	assertSuccess(t, del.mustExecuteRequest(nil))
+	assert.Equal(t, http.StatusNotFound, del.mustExecuteRequest(nil).Code)
+}
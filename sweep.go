@@ -0,0 +1,395 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	sweepMethod            = "sweep"
+	sweepMaxRuns           = 100
+	sweepDefaultMaxRunning = 2
+)
+
+// SweepRange model, a range random parameter values are drawn from
+type SweepRange struct {
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	Integer bool    `json:"integer"`
+}
+
+// SweepRequest model, params are fixed for all runs, grid values are combined with each other and
+// for every grid combination `samples` random values are drawn from the random ranges
+type SweepRequest struct {
+	Name        string                   `json:"name"`
+	Method      string                   `json:"method"`
+	Dataset     string                   `json:"dataset"`
+	Params      map[string]interface{}   `json:"params"`
+	Grid        map[string][]interface{} `json:"grid"`
+	Random      map[string]SweepRange    `json:"random"`
+	Samples     int                      `json:"samples"`
+	MaxRunning  int                      `json:"max_running"`
+	CallbackURL string                   `json:"callback_url"`
+	Force       bool                     `json:"force"`
+	Owner       string                   `json:"owner"`
+}
+
+// SweepRun model, summary of a single run of a sweep
+type SweepRun struct {
+	Name    string                 `json:"name"`
+	Params  map[string]string      `json:"params"`
+	Status  string                 `json:"status"`
+	Metrics map[string]interface{} `json:"metrics"`
+}
+
+// SweepGroup model, the runs that share a value of a swept parameter and the mean of their numeric metrics
+type SweepGroup struct {
+	Runs        []string           `json:"runs"`
+	Finished    int                `json:"finished"`
+	MeanMetrics map[string]float64 `json:"mean_metrics"`
+}
+
+// SweepSummary model, the runs of a sweep grouped by the values of each swept parameter
+type SweepSummary struct {
+	Name    string                           `json:"name"`
+	Method  string                           `json:"method"`
+	Dataset string                           `json:"dataset"`
+	Status  string                           `json:"status"`
+	Runs    []SweepRun                       `json:"runs"`
+	Groups  map[string]map[string]SweepGroup `json:"groups"`
+}
+
+var sweeps = struct {
+	sync.RWMutex
+	summaries map[string]*SweepSummary
+}{summaries: make(map[string]*SweepSummary)}
+
+// postStartSweep starts one detection per parameter combination
+func postStartSweep(w http.ResponseWriter, r *http.Request) {
+	var request SweepRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		fmt.Printf("ERROR decoding body: %s, body: %v\n", err, r.Body)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	fmt.Printf("postStartSweep called. Method: %v, Dataset: %v\n", request.Method, request.Dataset)
+
+	combinations, paramErrors := sweepCombinations(request)
+	if len(paramErrors) > 0 {
+		respondWithParamErrors(w, paramErrors)
+		return
+	}
+
+	dataset, err := getDatasets(request.Dataset)
+	if err != nil {
+		respondWithDatasetError(w, err)
+		return
+	}
+
+	parent := new(Result)
+	parent.Method = sweepMethod
+	parent.DatasetName = dataset.Name
+	parent.Status = statusScheduled
+	parent.StartedAt = time.Now()
+	parent.Params = stringifyParams(request.Params)
+	parent.Params["method"] = request.Method
+	parent.Name = request.Name
+	parent.CallbackURL = request.CallbackURL
+	parent.Owner = request.Owner
+
+	summary := &SweepSummary{Name: request.Name, Method: request.Method, Dataset: dataset.Name, Status: parent.Status}
+	var runs []*Result
+	for i, params := range combinations {
+		result := new(Result)
+		result.Method = request.Method
+		result.DatasetName = dataset.Name
+		result.Status = statusScheduled
+		result.StartedAt = time.Now()
+		result.Params = params
+		result.Name = fmt.Sprintf("%s/run-%d", request.Name, i+1)
+		result.Parent = parent.Name
+		result.Owner = request.Owner
+		runs = append(runs, result)
+		parent.Children = append(parent.Children, result.Name)
+		summary.Runs = append(summary.Runs, SweepRun{Name: result.Name, Params: params, Status: result.Status})
+	}
+
+	if err = storeResult(parent); err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+	for _, result := range runs {
+		if err = storeResult(result); err != nil {
+			respondWithStoreError(w, err)
+			return
+		}
+	}
+
+	// the response is encoded before the runs can update the summary
+	sweeps.Lock()
+	sweeps.summaries[summary.Name] = summary
+	response, _ := json.Marshal(summary)
+	sweeps.Unlock()
+
+	maxRunning := request.MaxRunning
+	if maxRunning <= 0 {
+		maxRunning = sweepDefaultMaxRunning
+	}
+	go _runSweep(parent, runs, dataset, maxRunning, request.Force)
+
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(response)
+}
+
+// getSweep returns the grouped summary of a sweep
+func getSweep(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	sweeps.RLock()
+	summary, ok := sweeps.summaries[name]
+	var response []byte
+	if ok {
+		response, _ = json.Marshal(summary)
+	}
+	sweeps.RUnlock()
+
+	w.Header().Set(contentTypeKey, contentTypeValJSON)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(ResponseMessage{Status: false, Message: "Sweep not found"})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(response)
+}
+
+// sweepCombinations validates the sweep and returns the params of every run
+func sweepCombinations(request SweepRequest) ([]map[string]string, []ParamError) {
+	var paramErrors []ParamError
+	if request.Name == "" {
+		paramErrors = append(paramErrors, ParamError{Field: "name", Message: "parameter is required"})
+	}
+	if request.Method == "" {
+		paramErrors = append(paramErrors, ParamError{Field: "method", Message: "parameter is required"})
+	}
+	if request.Dataset == "" {
+		paramErrors = append(paramErrors, ParamError{Field: "dataset", Message: "parameter is required"})
+	}
+	if callbackErr := validateCallbackURL(request.CallbackURL); callbackErr != nil {
+		paramErrors = append(paramErrors, *callbackErr)
+	}
+	for key, values := range request.Grid {
+		if len(values) == 0 {
+			paramErrors = append(paramErrors, ParamError{Field: "grid." + key, Message: "grid has no values"})
+		}
+	}
+	for key, valueRange := range request.Random {
+		if valueRange.Min > valueRange.Max {
+			paramErrors = append(paramErrors, ParamError{Field: "random." + key, Message: "min must be <= max"})
+		}
+	}
+	if len(request.Random) > 0 && request.Samples <= 0 {
+		paramErrors = append(paramErrors, ParamError{Field: "samples", Message: "must be > 0 for random ranges"})
+	}
+	// checked before multiplying, a large number of samples would overflow the number of runs
+	if request.Samples > sweepMaxRuns {
+		paramErrors = append(paramErrors, ParamError{Field: "samples", Message: fmt.Sprintf("must be <= %d", sweepMaxRuns)})
+	}
+	if len(paramErrors) > 0 {
+		return nil, paramErrors
+	}
+
+	numRuns := 1
+	for _, values := range request.Grid {
+		numRuns *= len(values)
+		if numRuns > sweepMaxRuns {
+			break
+		}
+	}
+	if len(request.Random) > 0 && numRuns <= sweepMaxRuns {
+		numRuns *= request.Samples
+	}
+	if numRuns > sweepMaxRuns {
+		return nil, []ParamError{{Field: "grid", Message: fmt.Sprintf("sweep has more than %d runs", sweepMaxRuns)}}
+	}
+
+	// build the cartesian product of the grid in a stable order
+	gridKeys := make([]string, 0, len(request.Grid))
+	for key := range request.Grid {
+		gridKeys = append(gridKeys, key)
+	}
+	sort.Strings(gridKeys)
+	combinations := []map[string]interface{}{{}}
+	for _, key := range gridKeys {
+		var next []map[string]interface{}
+		for _, combination := range combinations {
+			for _, value := range request.Grid[key] {
+				params := copyRawParams(combination)
+				params[key] = value
+				next = append(next, params)
+			}
+		}
+		combinations = next
+	}
+
+	if len(request.Random) > 0 {
+		randomKeys := make([]string, 0, len(request.Random))
+		for key := range request.Random {
+			randomKeys = append(randomKeys, key)
+		}
+		sort.Strings(randomKeys)
+		var next []map[string]interface{}
+		for _, combination := range combinations {
+			for i := 0; i < request.Samples; i++ {
+				params := copyRawParams(combination)
+				for _, key := range randomKeys {
+					params[key] = request.Random[key].sample()
+				}
+				next = append(next, params)
+			}
+		}
+		combinations = next
+	}
+
+	schema := methodRegistry.Resolve(request.Method).Params
+	var runParams []map[string]string
+	for i, combination := range combinations {
+		params := copyRawParams(request.Params)
+		for key, value := range combination {
+			params[key] = value
+		}
+		validated, runErrors := schema.Validate(params)
+		for _, runError := range runErrors {
+			paramErrors = append(paramErrors, ParamError{Field: fmt.Sprintf("runs[%d].%s", i, runError.Field), Message: runError.Message})
+		}
+		runParams = append(runParams, stringifyParams(validated))
+	}
+	return runParams, paramErrors
+}
+
+func copyRawParams(params map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		copied[key] = value
+	}
+	return copied
+}
+
+func (r SweepRange) sample() interface{} {
+	if r.Integer {
+		low, high := int64(math.Ceil(r.Min)), int64(math.Floor(r.Max))
+		if high < low {
+			return low
+		}
+		return low + rand.Int63n(high-low+1)
+	}
+	return r.Min + rand.Float64()*(r.Max-r.Min)
+}
+
+func _runSweep(parent *Result, runs []*Result, dataset Dataset, maxRunning int, force bool) {
+	parent.Status = statusStarted
+	jobJournal.StartParent(*parent)
+	_ = storeResult(parent)
+	updateSweep(parent.Name, func(summary *SweepSummary) { summary.Status = parent.Status })
+
+	running := make(chan struct{}, maxRunning)
+	var wg sync.WaitGroup
+	for i, result := range runs {
+		wg.Add(1)
+		running <- struct{}{}
+		go func(i int, result *Result) {
+			defer wg.Done()
+			defer func() { <-running }()
+
+			run := &Run{Method: result.Method, Params: result.Params, Dataset: dataset, Force: force}
+			updateSweep(parent.Name, func(summary *SweepSummary) { summary.Runs[i].Status = statusStarted })
+			endResult := _startNewDetection(result, run)
+			updateSweep(parent.Name, func(summary *SweepSummary) {
+				summary.Runs[i].Status = endResult.Status
+				summary.Runs[i].Metrics = endResult.Metrics
+			})
+		}(i, result)
+	}
+	wg.Wait()
+
+	var summary SweepSummary
+	updateSweep(parent.Name, func(s *SweepSummary) {
+		s.Status = statusFinished
+		for _, run := range s.Runs {
+			if run.Status != statusFinished {
+				s.Status = statusFailed
+			}
+		}
+		s.Groups = groupSweepRuns(s.Runs)
+		summary = *s
+	})
+
+	parent.Status = summary.Status
+	if summary.Status == statusFailed {
+		parent.Error = &ResultError{Message: "not all runs of the sweep finished", Category: errorCategoryDependency}
+	}
+	parent.Metrics = map[string]interface{}{"runs": summary.Runs, "groups": summary.Groups}
+	if err := storeResult(parent); !isInvalidTransition(err) {
+		notifyCallback(*parent)
+	}
+}
+
+func updateSweep(name string, update func(summary *SweepSummary)) {
+	sweeps.Lock()
+	defer sweeps.Unlock()
+	if summary, ok := sweeps.summaries[name]; ok {
+		update(summary)
+	}
+}
+
+// groupSweepRuns groups the runs by every parameter that differs between runs
+func groupSweepRuns(runs []SweepRun) map[string]map[string]SweepGroup {
+	values := make(map[string]map[string][]SweepRun)
+	for _, run := range runs {
+		for key, value := range run.Params {
+			if values[key] == nil {
+				values[key] = make(map[string][]SweepRun)
+			}
+			values[key][value] = append(values[key][value], run)
+		}
+	}
+
+	groups := make(map[string]map[string]SweepGroup)
+	for key, runsByValue := range values {
+		if len(runsByValue) < 2 {
+			continue
+		}
+		groups[key] = make(map[string]SweepGroup)
+		for value, groupRuns := range runsByValue {
+			group := SweepGroup{MeanMetrics: make(map[string]float64)}
+			counts := make(map[string]int)
+			for _, run := range groupRuns {
+				group.Runs = append(group.Runs, run.Name)
+				if run.Status != statusFinished {
+					continue
+				}
+				group.Finished++
+				for metric, metricValue := range run.Metrics {
+					if number, ok := metricValue.(float64); ok {
+						group.MeanMetrics[metric] += number
+						counts[metric]++
+					}
+				}
+			}
+			for metric, count := range counts {
+				group.MeanMetrics[metric] /= float64(count)
+			}
+			groups[key][value] = group
+		}
+	}
+	return groups
+}
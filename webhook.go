@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	callbackURLKey        = "callback_url"
+	headerWebhookEvent    = "X-Orchestration-Event"
+	headerWebhookSig      = "X-Orchestration-Signature"
+	webhookEventFinished  = "job.finished"
+	webhookEventFailed    = "job.failed"
+	webhookEventCancelled = "job.cancelled"
+	webhookMaxAttempts    = 3
+	webhookRetryBaseDelay = 2 * time.Second
+)
+
+var webhookSecret = os.Getenv("WEBHOOK_SECRET")
+
+var webhookClient = &http.Client{Timeout: 30 * time.Second}
+
+// ResultSummary model, the part of a Result that is sent to callbacks
+type ResultSummary struct {
+	Name        string                 `json:"name"`
+	Method      string                 `json:"method"`
+	Status      string                 `json:"status"`
+	StartedAt   time.Time              `json:"started_at"`
+	DatasetName string                 `json:"dataset_name"`
+	Params      map[string]string      `json:"params"`
+	Metrics     map[string]interface{} `json:"metrics"`
+	NumCodes    int                    `json:"num_codes"`
+	NumTopics   int                    `json:"num_topics"`
+	FinishedAt  *time.Time             `json:"finished_at,omitempty"`
+	Duration    float64                `json:"duration_seconds,omitempty"`
+	Attempts    int                    `json:"attempts,omitempty"`
+	Error       *ResultError           `json:"error,omitempty"`
+}
+
+// WebhookPayload model
+type WebhookPayload struct {
+	Event  string        `json:"event"`
+	SentAt time.Time     `json:"sent_at"`
+	Result ResultSummary `json:"result"`
+}
+
+// parseCallbackURL validates the optional callback url of a request body, "" means no callback
+func parseCallbackURL(body map[string]interface{}) (string, *ParamError) {
+	value, exists := body[callbackURLKey]
+	if !exists || value == nil {
+		return "", nil
+	}
+	callbackURL, ok := value.(string)
+	if !ok {
+		return "", &ParamError{Field: callbackURLKey, Message: "must be of type string"}
+	}
+	return callbackURL, validateCallbackURL(callbackURL)
+}
+
+// validateCallbackURL returns an error if the callback url is neither empty nor an absolute http(s) url
+func validateCallbackURL(callbackURL string) *ParamError {
+	if callbackURL == "" {
+		return nil
+	}
+	parsed, err := url.ParseRequestURI(callbackURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return &ParamError{Field: callbackURLKey, Message: "must be an absolute http(s) url"}
+	}
+	return nil
+}
+
+func summarizeResult(result Result) ResultSummary {
+	return ResultSummary{
+		Name:        result.Name,
+		Method:      result.Method,
+		Status:      result.Status,
+		StartedAt:   result.StartedAt,
+		DatasetName: result.DatasetName,
+		Params:      result.Params,
+		Metrics:     result.Metrics,
+		NumCodes:    len(result.Codes),
+		NumTopics:   len(result.Topics),
+		FinishedAt:  result.FinishedAt,
+		Duration:    result.DurationSeconds,
+		Attempts:    result.Attempts,
+		Error:       result.Error,
+	}
+}
+
+// signWebhookPayload returns the hex encoded HMAC-SHA256 of the payload using WEBHOOK_SECRET,
+// "" if no secret is configured
+func signWebhookPayload(payload []byte) string {
+	if webhookSecret == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(webhookSecret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// notifyCallback posts the result summary to the callback url of the result, if there is one.
+// The payload is sent and retried in the background, so the job is not delayed by the callback
+func notifyCallback(result Result) {
+	if result.CallbackURL == "" {
+		return
+	}
+	event := webhookEventFinished
+	switch result.Status {
+	case statusFailed:
+		event = webhookEventFailed
+	case statusCancelled:
+		event = webhookEventCancelled
+	}
+	payload, err := json.Marshal(WebhookPayload{Event: event, SentAt: time.Now(), Result: summarizeResult(result)})
+	if err != nil {
+		log.Printf(errJsonMessageTemplate, err)
+		return
+	}
+	go sendWebhook(result.CallbackURL, result.Name, event, signWebhookPayload(payload), payload)
+}
+
+// sendWebhook posts the payload to the callback url, up to webhookMaxAttempts times with increasing delays
+func sendWebhook(callbackURL string, name string, event string, signature string, payload []byte) {
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		err := postWebhook(callbackURL, event, signature, payload)
+		if err == nil {
+			return
+		}
+		log.Printf("ERR webhook %s for result %s, attempt %d: %v\n", callbackURL, name, attempt, err)
+		if attempt < webhookMaxAttempts {
+			time.Sleep(webhookRetryBaseDelay * time.Duration(attempt))
+		}
+	}
+}
+
+func postWebhook(callbackURL string, event string, signature string, payload []byte) error {
+	req, err := http.NewRequest(POST, callbackURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(contentTypeKey, contentTypeValJSON)
+	req.Header.Set(headerWebhookEvent, event)
+	if signature != "" {
+		req.Header.Set(headerWebhookSig, signature)
+	}
+	res, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("callback responded with status %d", res.StatusCode)
+	}
+	return nil
+}